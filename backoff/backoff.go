@@ -0,0 +1,65 @@
+// Package backoff provides the delays between the retries, i.e. of the
+// kernel reconnects, and the Langfuse batches.
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff decides how long to wait before the next attempt.
+type Backoff interface {
+	// NextDelay returns the delay before the retry, counting from zero.
+	NextDelay(attempt int) time.Duration
+}
+
+// Exponential doubles the delay on every attempt, from Base up to Max, if
+// set; the delay is randomized by up to the Jitter fraction either way, so
+// that the clients failed at once wouldn't retry in lockstep.
+type Exponential struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// Default is exponential from 100ms up to 30s, with 20% jitter.
+var Default Backoff = Exponential{
+	Base:   100 * time.Millisecond,
+	Max:    30 * time.Second,
+	Jitter: 0.2,
+}
+
+func (e Exponential) NextDelay(attempt int) time.Duration {
+	d := e.Base
+	for range attempt {
+		// without the Max, the delay is capped short of overflowing, jitter
+		// included
+		if d > math.MaxInt64/4 {
+			d = math.MaxInt64 / 4
+			break
+		}
+		d *= 2
+		if e.Max > 0 && d >= e.Max {
+			d = e.Max
+			break
+		}
+	}
+	if e.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * e.Jitter * float64(d))
+	}
+	return d
+}
+
+// Sleep waits out the delay before the retry, or until the context is done.
+func Sleep(ctx context.Context, b Backoff, attempt int) error {
+	t := time.NewTimer(b.NextDelay(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	b := Exponential{Base: 100 * time.Millisecond, Max: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for attempt, d := range want {
+		if got := b.NextDelay(attempt); got != d*time.Millisecond {
+			t.Fatalf("Expected %s before attempt %d, got %s", d*time.Millisecond, attempt, got)
+		}
+	}
+
+	b.Jitter = 0.5
+	for range 100 {
+		if d := b.NextDelay(2); d < 200*time.Millisecond || d > 600*time.Millisecond {
+			t.Fatalf("Expected 400ms ± 50%%, got %s", d)
+		}
+	}
+
+	b = Exponential{Base: 100 * time.Millisecond, Jitter: 0.5}
+	for _, attempt := range []int{36, 37, 64, 1000} {
+		if d := b.NextDelay(attempt); d < time.Hour {
+			t.Fatalf("Expected the delay to keep growing without the max, got %s before attempt %d", d, attempt)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Sleep(ctx, Default, 10); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the sleep cancelled, got %v", err)
+	}
+}
@@ -1,2 +1,142 @@
 // The cable controller is the interface to Jupyter Enterprise Gateway.
 package cablectl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/busthorne/cablectl/gateway"
+	"github.com/busthorne/cablectl/langfuse"
+	"github.com/google/uuid"
+)
+
+// RunTraced runs the code in the kernel, as Run does, and records it as a
+// span under the parent, or otherwise a trace of its own: the code is the
+// input, and the printed text, the result, and the images, uploaded as the
+// media, are the output; should the code raise, the span is an error.
+//
+// The images are uploaded once the execution is over, so as not to hold up
+// the stream; those that fail to upload are left out, and noted in the output.
+func RunTraced(ctx context.Context, k *gateway.Kernel, lf *langfuse.Client, parent *langfuse.Span, code string) (*gateway.ExecuteResult, error) {
+	span := &langfuse.Span{
+		Id:        uuid.New().String(),
+		Name:      "execute",
+		StartedAt: time.Now().UTC(),
+		Input:     code,
+	}
+	var trace *langfuse.Trace
+	if parent != nil {
+		span.TraceId = parent.TraceId
+	} else {
+		trace = &langfuse.Trace{Id: uuid.New().String(), Name: "execute", Input: code}
+		span.TraceId = trace.Id
+	}
+
+	var (
+		out    output
+		stream = make(chan *gateway.Content)
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for c := range stream {
+			out.add(c)
+		}
+	}()
+	r, err := k.Run(ctx, code, stream)
+	close(stream)
+	<-done
+	out.Stdout, out.Stderr = out.stdout.String(), out.stderr.String()
+
+	metadata := map[string]any{"kernel": k.ID.String()}
+	switch {
+	case err != nil:
+		span.Level = "ERROR"
+		span.StatusMessage = err.Error()
+	case r.Error != nil:
+		span.Level = "ERROR"
+		span.StatusMessage = r.Error.Error()
+		out.Error = r.Error.String()
+		fallthrough
+	default:
+		if r.Data != nil {
+			out.Result, _ = r.Data.Text()
+			out.displays = append(out.displays, r.Data)
+		}
+		metadata["execution_count"] = r.ExecutionCount
+		metadata["duration_ms"] = r.Duration.Milliseconds()
+	}
+	for _, d := range out.displays {
+		out.image(ctx, lf, span, d)
+	}
+	span.Output = &out
+	span.Metadata = metadata
+
+	if parent != nil {
+		parent.Span(span)
+	} else {
+		lf.Trace(trace).Span(span)
+	}
+	span.End()
+	return r, err
+}
+
+// output is the output of the traced execution.
+type output struct {
+	Stdout string   `json:"stdout,omitempty"`
+	Stderr string   `json:"stderr,omitempty"`
+	Result string   `json:"result,omitempty"`
+	Images []string `json:"images,omitempty"`
+	Error  string   `json:"error,omitempty"`
+
+	stdout, stderr strings.Builder
+	displays       []*gateway.Data // to upload the images of
+}
+
+func (o *output) add(c *gateway.Content) {
+	switch {
+	case c.Type == "stream" && c.Name == "stderr":
+		o.stderr.WriteString(c.Text)
+	case c.Type == "stream":
+		o.stdout.WriteString(c.Text)
+	case c.Type == "display_data" && c.Data != nil:
+		o.displays = append(o.displays, c.Data)
+	}
+}
+
+// image uploads the image of the data, if any, and adds its reference.
+func (o *output) image(ctx context.Context, lf *langfuse.Client, span *langfuse.Span, d *gateway.Data) {
+	var (
+		b    []byte
+		mime string
+		err  error
+	)
+	switch {
+	case d.PNG != "":
+		b, err = d.PNG.Bytes()
+		mime = "image/png"
+	case d.JPG != "":
+		b, err = d.JPG.Bytes()
+		mime = "image/jpeg"
+	case d.SVG != "":
+		b, mime = []byte(d.SVG), "image/svg+xml"
+	default:
+		return
+	}
+	ref := ""
+	if err == nil {
+		ref, err = lf.UploadMedia(ctx, &langfuse.Media{
+			TraceId:       span.TraceId,
+			ObservationId: span.Id,
+			Field:         "output",
+			ContentType:   mime,
+			Data:          b,
+		})
+	}
+	if err != nil {
+		ref = fmt.Sprintf("[%s: %v]", mime, err)
+	}
+	o.Images = append(o.Images, ref)
+}
@@ -0,0 +1,81 @@
+package cablectl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/busthorne/cablectl/gateway"
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+	"github.com/busthorne/cablectl/langfuse"
+)
+
+func TestRunTraced(t *testing.T) {
+	ctx := context.Background()
+	gw := gatewaytest.NewServer()
+	defer gw.Close()
+	gw.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{
+			Stdout:   "plotted",
+			Displays: []map[string]any{{"image/svg+xml": "<svg/>"}},
+			Result:   map[string]any{"text/plain": "Figure", "image/png": "cG5n"},
+			Delay:    100 * time.Millisecond,
+		}
+	}
+	u, _ := url.Parse(gw.URL)
+	k := &gateway.Kernel{Name: "python3", URL: u}
+	if err := gateway.NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	var start time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/media" {
+			http.NotFound(w, r)
+			return
+		}
+		if time.Since(start) < 100*time.Millisecond {
+			t.Errorf("Expected the images uploaded after the execution")
+		}
+		w.Write([]byte(`{"mediaId":"m","uploadUrl":null}`))
+	}))
+	defer srv.Close()
+	lf, err := langfuse.New(&langfuse.ClientOptions{Host: srv.URL, PublicKey: "pk", PrivateKey: "sk"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	sink := lf.Capture()
+
+	parent := lf.Trace(&langfuse.Trace{Name: "agent"}).Span(&langfuse.Span{Name: "tool"})
+	start = time.Now()
+	r, err := RunTraced(ctx, k, lf, parent, "plot()")
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Status != "ok" {
+		t.Fatalf("Expected ok, got %q", r.Status)
+	}
+	if err := lf.Flush(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	var span *langfuse.Span
+	for _, e := range sink.Events() {
+		if s, ok := e.(*langfuse.Span); ok && s.Name == "execute" {
+			span = s
+		}
+	}
+	if span == nil || span.ParentObservationId != parent.Id || span.Input != "plot()" {
+		t.Fatalf("Expected the execution span under the parent, got %+v", span)
+	}
+	b, _ := json.Marshal(span.Output)
+	want := `{"stdout":"plotted","result":"Figure","images":["@@@langfuseMedia:type=image/svg+xml|id=m|source=bytes@@@","@@@langfuseMedia:type=image/png|id=m|source=bytes@@@"]}`
+	if string(b) != want {
+		t.Fatalf("Unexpected output: %s", b)
+	}
+}
@@ -248,6 +248,12 @@ type ClientInterface interface {
 	// GetApiKernelsKernelIdChannels request
 	GetApiKernelsKernelIdChannels(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error)
 
+	// PostApiKernelsKernelIdInterrupt request
+	PostApiKernelsKernelIdInterrupt(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error)
+
+	// PostApiKernelsKernelIdRestart request
+	PostApiKernelsKernelIdRestart(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error)
+
 	// GetApiKernelspecs request
 	GetApiKernelspecs(ctx context.Context, params *GetApiKernelspecsParams, reqEditors ...RequestEditorFn) (*http.Response, error)
 
@@ -275,12 +281,6 @@ type ClientInterface interface {
 
 	// GetApiSwaggerYaml request
 	GetApiSwaggerYaml(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error)
-
-	// PostKernelsKernelIdInterrupt request
-	PostKernelsKernelIdInterrupt(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error)
-
-	// PostKernelsKernelIdRestart request
-	PostKernelsKernelIdRestart(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error)
 }
 
 func (c *Client) GetApi(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
@@ -367,8 +367,8 @@ func (c *Client) GetApiKernelsKernelIdChannels(ctx context.Context, kernelId ope
 	return c.Client.Do(req)
 }
 
-func (c *Client) GetApiKernelspecs(ctx context.Context, params *GetApiKernelspecsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewGetApiKernelspecsRequest(c.Server, params)
+func (c *Client) PostApiKernelsKernelIdInterrupt(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApiKernelsKernelIdInterruptRequest(c.Server, kernelId)
 	if err != nil {
 		return nil, err
 	}
@@ -379,8 +379,8 @@ func (c *Client) GetApiKernelspecs(ctx context.Context, params *GetApiKernelspec
 	return c.Client.Do(req)
 }
 
-func (c *Client) GetApiSessions(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewGetApiSessionsRequest(c.Server)
+func (c *Client) PostApiKernelsKernelIdRestart(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApiKernelsKernelIdRestartRequest(c.Server, kernelId)
 	if err != nil {
 		return nil, err
 	}
@@ -391,8 +391,8 @@ func (c *Client) GetApiSessions(ctx context.Context, reqEditors ...RequestEditor
 	return c.Client.Do(req)
 }
 
-func (c *Client) PostApiSessionsWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPostApiSessionsRequestWithBody(c.Server, contentType, body)
+func (c *Client) GetApiKernelspecs(ctx context.Context, params *GetApiKernelspecsParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetApiKernelspecsRequest(c.Server, params)
 	if err != nil {
 		return nil, err
 	}
@@ -403,8 +403,8 @@ func (c *Client) PostApiSessionsWithBody(ctx context.Context, contentType string
 	return c.Client.Do(req)
 }
 
-func (c *Client) PostApiSessions(ctx context.Context, body PostApiSessionsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPostApiSessionsRequest(c.Server, body)
+func (c *Client) GetApiSessions(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetApiSessionsRequest(c.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -415,8 +415,8 @@ func (c *Client) PostApiSessions(ctx context.Context, body PostApiSessionsJSONRe
 	return c.Client.Do(req)
 }
 
-func (c *Client) DeleteApiSessionsSession(ctx context.Context, session openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewDeleteApiSessionsSessionRequest(c.Server, session)
+func (c *Client) PostApiSessionsWithBody(ctx context.Context, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApiSessionsRequestWithBody(c.Server, contentType, body)
 	if err != nil {
 		return nil, err
 	}
@@ -427,8 +427,8 @@ func (c *Client) DeleteApiSessionsSession(ctx context.Context, session openapi_t
 	return c.Client.Do(req)
 }
 
-func (c *Client) GetApiSessionsSession(ctx context.Context, session openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewGetApiSessionsSessionRequest(c.Server, session)
+func (c *Client) PostApiSessions(ctx context.Context, body PostApiSessionsJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPostApiSessionsRequest(c.Server, body)
 	if err != nil {
 		return nil, err
 	}
@@ -439,8 +439,8 @@ func (c *Client) GetApiSessionsSession(ctx context.Context, session openapi_type
 	return c.Client.Do(req)
 }
 
-func (c *Client) PatchApiSessionsSessionWithBody(ctx context.Context, session openapi_types.UUID, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPatchApiSessionsSessionRequestWithBody(c.Server, session, contentType, body)
+func (c *Client) DeleteApiSessionsSession(ctx context.Context, session openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewDeleteApiSessionsSessionRequest(c.Server, session)
 	if err != nil {
 		return nil, err
 	}
@@ -451,8 +451,8 @@ func (c *Client) PatchApiSessionsSessionWithBody(ctx context.Context, session op
 	return c.Client.Do(req)
 }
 
-func (c *Client) PatchApiSessionsSession(ctx context.Context, session openapi_types.UUID, body PatchApiSessionsSessionJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPatchApiSessionsSessionRequest(c.Server, session, body)
+func (c *Client) GetApiSessionsSession(ctx context.Context, session openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetApiSessionsSessionRequest(c.Server, session)
 	if err != nil {
 		return nil, err
 	}
@@ -463,8 +463,8 @@ func (c *Client) PatchApiSessionsSession(ctx context.Context, session openapi_ty
 	return c.Client.Do(req)
 }
 
-func (c *Client) GetApiSwaggerJson(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewGetApiSwaggerJsonRequest(c.Server)
+func (c *Client) PatchApiSessionsSessionWithBody(ctx context.Context, session openapi_types.UUID, contentType string, body io.Reader, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPatchApiSessionsSessionRequestWithBody(c.Server, session, contentType, body)
 	if err != nil {
 		return nil, err
 	}
@@ -475,8 +475,8 @@ func (c *Client) GetApiSwaggerJson(ctx context.Context, reqEditors ...RequestEdi
 	return c.Client.Do(req)
 }
 
-func (c *Client) GetApiSwaggerYaml(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewGetApiSwaggerYamlRequest(c.Server)
+func (c *Client) PatchApiSessionsSession(ctx context.Context, session openapi_types.UUID, body PatchApiSessionsSessionJSONRequestBody, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewPatchApiSessionsSessionRequest(c.Server, session, body)
 	if err != nil {
 		return nil, err
 	}
@@ -487,8 +487,8 @@ func (c *Client) GetApiSwaggerYaml(ctx context.Context, reqEditors ...RequestEdi
 	return c.Client.Do(req)
 }
 
-func (c *Client) PostKernelsKernelIdInterrupt(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPostKernelsKernelIdInterruptRequest(c.Server, kernelId)
+func (c *Client) GetApiSwaggerJson(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetApiSwaggerJsonRequest(c.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -499,8 +499,8 @@ func (c *Client) PostKernelsKernelIdInterrupt(ctx context.Context, kernelId open
 	return c.Client.Do(req)
 }
 
-func (c *Client) PostKernelsKernelIdRestart(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*http.Response, error) {
-	req, err := NewPostKernelsKernelIdRestartRequest(c.Server, kernelId)
+func (c *Client) GetApiSwaggerYaml(ctx context.Context, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewGetApiSwaggerYamlRequest(c.Server)
 	if err != nil {
 		return nil, err
 	}
@@ -707,6 +707,74 @@ func NewGetApiKernelsKernelIdChannelsRequest(server string, kernelId openapi_typ
 	return req, nil
 }
 
+// NewPostApiKernelsKernelIdInterruptRequest generates requests for PostApiKernelsKernelIdInterrupt
+func NewPostApiKernelsKernelIdInterruptRequest(server string, kernelId openapi_types.UUID) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "kernel_id", runtime.ParamLocationPath, kernelId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/api/kernels/%s/interrupt", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// NewPostApiKernelsKernelIdRestartRequest generates requests for PostApiKernelsKernelIdRestart
+func NewPostApiKernelsKernelIdRestartRequest(server string, kernelId openapi_types.UUID) (*http.Request, error) {
+	var err error
+
+	var pathParam0 string
+
+	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "kernel_id", runtime.ParamLocationPath, kernelId)
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	operationPath := fmt.Sprintf("/api/kernels/%s/restart", pathParam0)
+	if operationPath[0] == '/' {
+		operationPath = "." + operationPath
+	}
+
+	queryURL, err := serverURL.Parse(operationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 // NewGetApiKernelspecsRequest generates requests for GetApiKernelspecs
 func NewGetApiKernelspecsRequest(server string, params *GetApiKernelspecsParams) (*http.Request, error) {
 	var err error
@@ -992,74 +1060,6 @@ func NewGetApiSwaggerYamlRequest(server string) (*http.Request, error) {
 	return req, nil
 }
 
-// NewPostKernelsKernelIdInterruptRequest generates requests for PostKernelsKernelIdInterrupt
-func NewPostKernelsKernelIdInterruptRequest(server string, kernelId openapi_types.UUID) (*http.Request, error) {
-	var err error
-
-	var pathParam0 string
-
-	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "kernel_id", runtime.ParamLocationPath, kernelId)
-	if err != nil {
-		return nil, err
-	}
-
-	serverURL, err := url.Parse(server)
-	if err != nil {
-		return nil, err
-	}
-
-	operationPath := fmt.Sprintf("/kernels/%s/interrupt", pathParam0)
-	if operationPath[0] == '/' {
-		operationPath = "." + operationPath
-	}
-
-	queryURL, err := serverURL.Parse(operationPath)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", queryURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return req, nil
-}
-
-// NewPostKernelsKernelIdRestartRequest generates requests for PostKernelsKernelIdRestart
-func NewPostKernelsKernelIdRestartRequest(server string, kernelId openapi_types.UUID) (*http.Request, error) {
-	var err error
-
-	var pathParam0 string
-
-	pathParam0, err = runtime.StyleParamWithLocation("simple", false, "kernel_id", runtime.ParamLocationPath, kernelId)
-	if err != nil {
-		return nil, err
-	}
-
-	serverURL, err := url.Parse(server)
-	if err != nil {
-		return nil, err
-	}
-
-	operationPath := fmt.Sprintf("/kernels/%s/restart", pathParam0)
-	if operationPath[0] == '/' {
-		operationPath = "." + operationPath
-	}
-
-	queryURL, err := serverURL.Parse(operationPath)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", queryURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return req, nil
-}
-
 func (c *Client) applyEditors(ctx context.Context, req *http.Request, additionalEditors []RequestEditorFn) error {
 	for _, r := range c.RequestEditors {
 		if err := r(ctx, req); err != nil {
@@ -1123,6 +1123,12 @@ type ClientWithResponsesInterface interface {
 	// GetApiKernelsKernelIdChannelsWithResponse request
 	GetApiKernelsKernelIdChannelsWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*GetApiKernelsKernelIdChannelsResponse, error)
 
+	// PostApiKernelsKernelIdInterruptWithResponse request
+	PostApiKernelsKernelIdInterruptWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostApiKernelsKernelIdInterruptResponse, error)
+
+	// PostApiKernelsKernelIdRestartWithResponse request
+	PostApiKernelsKernelIdRestartWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostApiKernelsKernelIdRestartResponse, error)
+
 	// GetApiKernelspecsWithResponse request
 	GetApiKernelspecsWithResponse(ctx context.Context, params *GetApiKernelspecsParams, reqEditors ...RequestEditorFn) (*GetApiKernelspecsResponse, error)
 
@@ -1150,12 +1156,6 @@ type ClientWithResponsesInterface interface {
 
 	// GetApiSwaggerYamlWithResponse request
 	GetApiSwaggerYamlWithResponse(ctx context.Context, reqEditors ...RequestEditorFn) (*GetApiSwaggerYamlResponse, error)
-
-	// PostKernelsKernelIdInterruptWithResponse request
-	PostKernelsKernelIdInterruptWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostKernelsKernelIdInterruptResponse, error)
-
-	// PostKernelsKernelIdRestartWithResponse request
-	PostKernelsKernelIdRestartWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostKernelsKernelIdRestartResponse, error)
 }
 
 type GetApiResponse struct {
@@ -1290,18 +1290,13 @@ func (r GetApiKernelsKernelIdChannelsResponse) StatusCode() int {
 	return 0
 }
 
-type GetApiKernelspecsResponse struct {
+type PostApiKernelsKernelIdInterruptResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON200      *struct {
-		// Default The name of the default kernel.
-		Default     *string                `json:"default,omitempty"`
-		Kernelspecs *map[string]KernelSpec `json:"kernelspecs,omitempty"`
-	}
 }
 
 // Status returns HTTPResponse.Status
-func (r GetApiKernelspecsResponse) Status() string {
+func (r PostApiKernelsKernelIdInterruptResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1309,22 +1304,21 @@ func (r GetApiKernelspecsResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r GetApiKernelspecsResponse) StatusCode() int {
+func (r PostApiKernelsKernelIdInterruptResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type GetApiSessionsResponse struct {
+type PostApiKernelsKernelIdRestartResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON200      *[]Session
-	JSON403      *Error
+	JSON200      *Kernel
 }
 
 // Status returns HTTPResponse.Status
-func (r GetApiSessionsResponse) Status() string {
+func (r PostApiKernelsKernelIdRestartResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1332,22 +1326,25 @@ func (r GetApiSessionsResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r GetApiSessionsResponse) StatusCode() int {
+func (r PostApiKernelsKernelIdRestartResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type PostApiSessionsResponse struct {
+type GetApiKernelspecsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON201      *Session
-	JSON501      *Error
+	JSON200      *struct {
+		// Default The name of the default kernel.
+		Default     *string                `json:"default,omitempty"`
+		Kernelspecs *map[string]KernelSpec `json:"kernelspecs,omitempty"`
+	}
 }
 
 // Status returns HTTPResponse.Status
-func (r PostApiSessionsResponse) Status() string {
+func (r GetApiKernelspecsResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1355,20 +1352,22 @@ func (r PostApiSessionsResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r PostApiSessionsResponse) StatusCode() int {
+func (r GetApiKernelspecsResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type DeleteApiSessionsSessionResponse struct {
+type GetApiSessionsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
+	JSON200      *[]Session
+	JSON403      *Error
 }
 
 // Status returns HTTPResponse.Status
-func (r DeleteApiSessionsSessionResponse) Status() string {
+func (r GetApiSessionsResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1376,21 +1375,22 @@ func (r DeleteApiSessionsSessionResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r DeleteApiSessionsSessionResponse) StatusCode() int {
+func (r GetApiSessionsResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type GetApiSessionsSessionResponse struct {
+type PostApiSessionsResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON200      *Session
+	JSON201      *Session
+	JSON501      *Error
 }
 
 // Status returns HTTPResponse.Status
-func (r GetApiSessionsSessionResponse) Status() string {
+func (r PostApiSessionsResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1398,22 +1398,20 @@ func (r GetApiSessionsSessionResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r GetApiSessionsSessionResponse) StatusCode() int {
+func (r PostApiSessionsResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type PatchApiSessionsSessionResponse struct {
+type DeleteApiSessionsSessionResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON200      *Session
-	JSON400      *Error
 }
 
 // Status returns HTTPResponse.Status
-func (r PatchApiSessionsSessionResponse) Status() string {
+func (r DeleteApiSessionsSessionResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1421,20 +1419,21 @@ func (r PatchApiSessionsSessionResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r PatchApiSessionsSessionResponse) StatusCode() int {
+func (r DeleteApiSessionsSessionResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type GetApiSwaggerJsonResponse struct {
+type GetApiSessionsSessionResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
+	JSON200      *Session
 }
 
 // Status returns HTTPResponse.Status
-func (r GetApiSwaggerJsonResponse) Status() string {
+func (r GetApiSessionsSessionResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1442,20 +1441,22 @@ func (r GetApiSwaggerJsonResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r GetApiSwaggerJsonResponse) StatusCode() int {
+func (r GetApiSessionsSessionResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type GetApiSwaggerYamlResponse struct {
+type PatchApiSessionsSessionResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
+	JSON200      *Session
+	JSON400      *Error
 }
 
 // Status returns HTTPResponse.Status
-func (r GetApiSwaggerYamlResponse) Status() string {
+func (r PatchApiSessionsSessionResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1463,20 +1464,20 @@ func (r GetApiSwaggerYamlResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r GetApiSwaggerYamlResponse) StatusCode() int {
+func (r PatchApiSessionsSessionResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type PostKernelsKernelIdInterruptResponse struct {
+type GetApiSwaggerJsonResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
 }
 
 // Status returns HTTPResponse.Status
-func (r PostKernelsKernelIdInterruptResponse) Status() string {
+func (r GetApiSwaggerJsonResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1484,21 +1485,20 @@ func (r PostKernelsKernelIdInterruptResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r PostKernelsKernelIdInterruptResponse) StatusCode() int {
+func (r GetApiSwaggerJsonResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
 	return 0
 }
 
-type PostKernelsKernelIdRestartResponse struct {
+type GetApiSwaggerYamlResponse struct {
 	Body         []byte
 	HTTPResponse *http.Response
-	JSON200      *Kernel
 }
 
 // Status returns HTTPResponse.Status
-func (r PostKernelsKernelIdRestartResponse) Status() string {
+func (r GetApiSwaggerYamlResponse) Status() string {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.Status
 	}
@@ -1506,7 +1506,7 @@ func (r PostKernelsKernelIdRestartResponse) Status() string {
 }
 
 // StatusCode returns HTTPResponse.StatusCode
-func (r PostKernelsKernelIdRestartResponse) StatusCode() int {
+func (r GetApiSwaggerYamlResponse) StatusCode() int {
 	if r.HTTPResponse != nil {
 		return r.HTTPResponse.StatusCode
 	}
@@ -1575,6 +1575,24 @@ func (c *ClientWithResponses) GetApiKernelsKernelIdChannelsWithResponse(ctx cont
 	return ParseGetApiKernelsKernelIdChannelsResponse(rsp)
 }
 
+// PostApiKernelsKernelIdInterruptWithResponse request returning *PostApiKernelsKernelIdInterruptResponse
+func (c *ClientWithResponses) PostApiKernelsKernelIdInterruptWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostApiKernelsKernelIdInterruptResponse, error) {
+	rsp, err := c.PostApiKernelsKernelIdInterrupt(ctx, kernelId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostApiKernelsKernelIdInterruptResponse(rsp)
+}
+
+// PostApiKernelsKernelIdRestartWithResponse request returning *PostApiKernelsKernelIdRestartResponse
+func (c *ClientWithResponses) PostApiKernelsKernelIdRestartWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostApiKernelsKernelIdRestartResponse, error) {
+	rsp, err := c.PostApiKernelsKernelIdRestart(ctx, kernelId, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePostApiKernelsKernelIdRestartResponse(rsp)
+}
+
 // GetApiKernelspecsWithResponse request returning *GetApiKernelspecsResponse
 func (c *ClientWithResponses) GetApiKernelspecsWithResponse(ctx context.Context, params *GetApiKernelspecsParams, reqEditors ...RequestEditorFn) (*GetApiKernelspecsResponse, error) {
 	rsp, err := c.GetApiKernelspecs(ctx, params, reqEditors...)
@@ -1663,24 +1681,6 @@ func (c *ClientWithResponses) GetApiSwaggerYamlWithResponse(ctx context.Context,
 	return ParseGetApiSwaggerYamlResponse(rsp)
 }
 
-// PostKernelsKernelIdInterruptWithResponse request returning *PostKernelsKernelIdInterruptResponse
-func (c *ClientWithResponses) PostKernelsKernelIdInterruptWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostKernelsKernelIdInterruptResponse, error) {
-	rsp, err := c.PostKernelsKernelIdInterrupt(ctx, kernelId, reqEditors...)
-	if err != nil {
-		return nil, err
-	}
-	return ParsePostKernelsKernelIdInterruptResponse(rsp)
-}
-
-// PostKernelsKernelIdRestartWithResponse request returning *PostKernelsKernelIdRestartResponse
-func (c *ClientWithResponses) PostKernelsKernelIdRestartWithResponse(ctx context.Context, kernelId openapi_types.UUID, reqEditors ...RequestEditorFn) (*PostKernelsKernelIdRestartResponse, error) {
-	rsp, err := c.PostKernelsKernelIdRestart(ctx, kernelId, reqEditors...)
-	if err != nil {
-		return nil, err
-	}
-	return ParsePostKernelsKernelIdRestartResponse(rsp)
-}
-
 // ParseGetApiResponse parses an HTTP response from a GetApiWithResponse call
 func ParseGetApiResponse(rsp *http.Response) (*GetApiResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -1831,6 +1831,48 @@ func ParseGetApiKernelsKernelIdChannelsResponse(rsp *http.Response) (*GetApiKern
 	return response, nil
 }
 
+// ParsePostApiKernelsKernelIdInterruptResponse parses an HTTP response from a PostApiKernelsKernelIdInterruptWithResponse call
+func ParsePostApiKernelsKernelIdInterruptResponse(rsp *http.Response) (*PostApiKernelsKernelIdInterruptResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PostApiKernelsKernelIdInterruptResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	return response, nil
+}
+
+// ParsePostApiKernelsKernelIdRestartResponse parses an HTTP response from a PostApiKernelsKernelIdRestartWithResponse call
+func ParsePostApiKernelsKernelIdRestartResponse(rsp *http.Response) (*PostApiKernelsKernelIdRestartResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PostApiKernelsKernelIdRestartResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest Kernel
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+
+	}
+
+	return response, nil
+}
+
 // ParseGetApiKernelspecsResponse parses an HTTP response from a GetApiKernelspecsWithResponse call
 func ParseGetApiKernelspecsResponse(rsp *http.Response) (*GetApiKernelspecsResponse, error) {
 	bodyBytes, err := io.ReadAll(rsp.Body)
@@ -2033,45 +2075,3 @@ func ParseGetApiSwaggerYamlResponse(rsp *http.Response) (*GetApiSwaggerYamlRespo
 
 	return response, nil
 }
-
-// ParsePostKernelsKernelIdInterruptResponse parses an HTTP response from a PostKernelsKernelIdInterruptWithResponse call
-func ParsePostKernelsKernelIdInterruptResponse(rsp *http.Response) (*PostKernelsKernelIdInterruptResponse, error) {
-	bodyBytes, err := io.ReadAll(rsp.Body)
-	defer func() { _ = rsp.Body.Close() }()
-	if err != nil {
-		return nil, err
-	}
-
-	response := &PostKernelsKernelIdInterruptResponse{
-		Body:         bodyBytes,
-		HTTPResponse: rsp,
-	}
-
-	return response, nil
-}
-
-// ParsePostKernelsKernelIdRestartResponse parses an HTTP response from a PostKernelsKernelIdRestartWithResponse call
-func ParsePostKernelsKernelIdRestartResponse(rsp *http.Response) (*PostKernelsKernelIdRestartResponse, error) {
-	bodyBytes, err := io.ReadAll(rsp.Body)
-	defer func() { _ = rsp.Body.Close() }()
-	if err != nil {
-		return nil, err
-	}
-
-	response := &PostKernelsKernelIdRestartResponse{
-		Body:         bodyBytes,
-		HTTPResponse: rsp,
-	}
-
-	switch {
-	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
-		var dest Kernel
-		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
-			return nil, err
-		}
-		response.JSON200 = &dest
-
-	}
-
-	return response, nil
-}
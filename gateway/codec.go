@@ -0,0 +1,15 @@
+package gateway
+
+import "github.com/busthorne/cablectl/internal/jsoncodec"
+
+// Codec is the JSON implementation of the kernel messages, see SetCodec.
+type Codec = jsoncodec.Codec
+
+var codec jsoncodec.Value
+
+// SetCodec replaces encoding/json with the codec for the messages on the
+// wire, and their content, which is where the image-heavy outputs are
+// decoded; nil restores encoding/json.
+func SetCodec(c Codec) {
+	codec.Set(c)
+}
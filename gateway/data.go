@@ -0,0 +1,329 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// String64 is a base64 encoded string.
+type String64 string
+
+func (s String64) Bytes() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(string(s))
+}
+
+// Reader decodes the string as it's read, so that large images could be
+// piped to a file, or HTTP response, without being decoded in memory.
+func (s String64) Reader() io.Reader {
+	return base64.NewDecoder(base64.StdEncoding, strings.NewReader(string(s)))
+}
+
+type Data struct {
+	Plaintext string `json:"text/plain,omitempty"`
+	Markdown  string `json:"text/markdown,omitempty"`
+	Latex     string `json:"text/latex,omitempty"`
+	JS        string `json:"application/javascript,omitempty"`
+	JSON      string `json:"-"` // application/json, see JSONValue
+	HTML      string `json:"text/html,omitempty"`
+
+	PNG String64 `json:"image/png,omitempty"`
+	JPG String64 `json:"image/jpeg,omitempty"`
+	SVG String64 `json:"image/svg+xml,omitempty"`
+
+	VegaLite json.RawMessage `json:"application/vnd.vegalite.v5+json,omitempty"`
+	Vega     json.RawMessage `json:"application/vnd.vega.v5+json,omitempty"`
+
+	// Extra holds the representations of any other MIME type.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+var knownMIME = map[string]bool{
+	"text/plain":                       true,
+	"text/markdown":                    true,
+	"text/latex":                       true,
+	"application/javascript":           true,
+	"application/json":                 true,
+	"text/html":                        true,
+	"image/png":                        true,
+	"image/jpeg":                       true,
+	"image/svg+xml":                    true,
+	"application/vnd.vegalite.v5+json": true,
+	"application/vnd.vega.v5+json":     true,
+}
+
+// MarshalJSON encodes the MIME bundle, including the Extra representations.
+func (m Data) MarshalJSON() ([]byte, error) {
+	type data Data
+	b, err := codec.Get().Marshal(data(m))
+	if err != nil || len(m.Extra) == 0 && m.JSON == "" {
+		return b, err
+	}
+	var bundle map[string]json.RawMessage
+	if err := codec.Get().Unmarshal(b, &bundle); err != nil {
+		return nil, err
+	}
+	if m.JSON != "" {
+		v := json.RawMessage(m.JSON)
+		if !json.Valid(v) {
+			if v, err = codec.Get().Marshal(m.JSON); err != nil {
+				return nil, err
+			}
+		}
+		bundle["application/json"] = v
+	}
+	for mime, v := range m.Extra {
+		if _, ok := bundle[mime]; !ok {
+			bundle[mime] = v
+		}
+	}
+	return codec.Get().Marshal(bundle)
+}
+
+// UnmarshalJSON decodes the MIME bundle, so that no representation is lost:
+// the unknown MIME types are kept in Extra.
+func (m *Data) UnmarshalJSON(b []byte) error {
+	type data Data
+	if err := codec.Get().Unmarshal(b, (*data)(m)); err != nil {
+		return err
+	}
+	var bundle map[string]json.RawMessage
+	if err := codec.Get().Unmarshal(b, &bundle); err != nil {
+		return err
+	}
+	if v := bundle["application/json"]; len(v) > 0 {
+		// the older kernels send the text, rather than the object
+		if err := codec.Get().Unmarshal(v, &m.JSON); err != nil {
+			m.JSON = string(v)
+		}
+	}
+	for mime, v := range bundle {
+		if knownMIME[mime] {
+			continue
+		}
+		if m.Extra == nil {
+			m.Extra = make(map[string]json.RawMessage)
+		}
+		m.Extra[mime] = v
+	}
+	return nil
+}
+
+// Get returns the representation of the given MIME type, if present.
+//
+// Note that binary representations are returned base64-encoded.
+func (m *Data) Get(mime string) (string, bool) {
+	var s string
+	switch mime {
+	case "text/plain":
+		s = m.Plaintext
+	case "text/markdown":
+		s = m.Markdown
+	case "text/latex":
+		s = m.Latex
+	case "application/javascript":
+		s = m.JS
+	case "application/json":
+		s = m.JSON
+	case "text/html":
+		s = m.HTML
+	case "image/png":
+		s = string(m.PNG)
+	case "image/jpeg":
+		s = string(m.JPG)
+	case "image/svg+xml":
+		s = string(m.SVG)
+	case "application/vnd.vegalite.v5+json":
+		s = string(m.VegaLite)
+	case "application/vnd.vega.v5+json":
+		s = string(m.Vega)
+	default:
+		s = string(m.Extra[mime])
+	}
+	return s, s != ""
+}
+
+// MIMETypes returns the MIME types of the representations present, including
+// the Extra ones, sorted.
+func (m *Data) MIMETypes() []string {
+	var types []string
+	for mime := range knownMIME {
+		if _, ok := m.Get(mime); ok {
+			types = append(types, mime)
+		}
+	}
+	for mime, v := range m.Extra {
+		if len(v) > 0 && !knownMIME[mime] {
+			types = append(types, mime)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// IsEmpty tells whether the bundle has no representation at all; the data
+// of only the unknown MIME types is not empty, see Extra.
+func (m *Data) IsEmpty() bool {
+	return m == nil || len(m.MIMETypes()) == 0
+}
+
+// Best returns the first available representation from the ordered list
+// of preferred MIME types.
+func (m *Data) Best(order []string) (mime, content string, ok bool) {
+	for _, mime := range order {
+		if content, ok := m.Get(mime); ok {
+			return mime, content, true
+		}
+	}
+	return "", "", false
+}
+
+// HTMLPolicy is the default policy of SanitizedHTML: the user-generated
+// content allowlist, permitting the styling of tables, e.g. the pandas
+// DataFrame, by class, as opposed to inline styles, or scripts.
+func HTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Globally()
+	p.AllowAttrs("border").OnElements("table")
+	return p
+}
+
+// SanitizedHTML returns the text/html representation, if present, run
+// through the policy, or HTMLPolicy, if nil, as the kernel output is not
+// to be trusted.
+func (m *Data) SanitizedHTML(policy *bluemonday.Policy) (string, bool) {
+	if m.HTML == "" {
+		return "", false
+	}
+	if policy == nil {
+		policy = HTMLPolicy()
+	}
+	return policy.Sanitize(m.HTML), true
+}
+
+// JSONValue decodes the application/json representation, if present.
+//
+// The JSON field holds its text, whether the kernel sent the object, or, as
+// the older kernels do, the string.
+func (m *Data) JSONValue() (any, error) {
+	if m.JSON == "" {
+		return nil, nil
+	}
+	var v any
+	if err := codec.Get().Unmarshal([]byte(m.JSON), &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json data: %w", err)
+	}
+	return v, nil
+}
+
+// Plotly returns the figure JSON, if present.
+//
+// The figure is a plain {data, layout} object, which you can render with
+// plotly.js on the web: `Plotly.newPlot(el, fig.data, fig.layout)`, or
+// otherwise export to image with kaleido.
+func (m *Data) Plotly() (json.RawMessage, bool) {
+	fig, ok := m.Extra["application/vnd.plotly.v1+json"]
+	return fig, ok
+}
+
+// Text returns the best textual representation, preferring plain text.
+func (m *Data) Text() (string, bool) {
+	_, s, ok := m.Best(textOrder)
+	return s, ok
+}
+
+var textOrder = []string{
+	"text/plain",
+	"text/markdown",
+	"text/latex",
+	"application/javascript",
+	"application/json",
+	"text/html",
+}
+
+// Multipart returns the richest binary representation, if any, or io.EOF.
+func (m *Data) Multipart() (b []byte, mimeType string, err error) {
+	r, mimeType := m.binary()
+	if r == nil {
+		return nil, "", io.EOF
+	}
+	b, err = io.ReadAll(r)
+	return
+}
+
+// Extension returns the file extension of the richest representation.
+func (m *Data) Extension() string {
+	mime, _, ok := m.Best(richOrder)
+	if !ok {
+		return ""
+	}
+	return extensions[mime]
+}
+
+// Save writes the richest binary representation to the directory, under
+// the basename with the appropriate extension, and returns the path.
+//
+// If there's no binary representation, io.EOF is returned.
+func (m *Data) Save(dir, basename string) (path string, err error) {
+	r, mime := m.binary()
+	if r == nil {
+		return "", io.EOF
+	}
+	path = filepath.Join(dir, basename+extensions[mime])
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// binary returns the reader of the richest binary representation.
+//
+// Note that SVG, being XML, is not base64-encoded like the other images.
+func (m *Data) binary() (io.Reader, string) {
+	switch {
+	case m.PNG != "":
+		return m.PNG.Reader(), "image/png"
+	case m.JPG != "":
+		return m.JPG.Reader(), "image/jpeg"
+	case m.SVG != "":
+		return strings.NewReader(string(m.SVG)), "image/svg+xml"
+	}
+	return nil, ""
+}
+
+var richOrder = []string{
+	"image/png",
+	"image/jpeg",
+	"image/svg+xml",
+	"text/html",
+	"text/markdown",
+	"text/latex",
+	"application/json",
+	"application/javascript",
+	"text/plain",
+}
+
+var extensions = map[string]string{
+	"image/png":              ".png",
+	"image/jpeg":             ".jpg",
+	"image/svg+xml":          ".svg",
+	"text/html":              ".html",
+	"text/markdown":          ".md",
+	"text/latex":             ".tex",
+	"application/json":       ".json",
+	"application/javascript": ".js",
+	"text/plain":             ".txt",
+}
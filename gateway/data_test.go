@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDataRoundTrip(t *testing.T) {
+	const bundle = `{
+		"text/plain": "<Figure>",
+		"image/png": "iVBORw0KGgo=",
+		"application/vnd.custom+json": {"answer": 42}
+	}`
+
+	var d Data
+	if err := json.Unmarshal([]byte(bundle), &d); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if d.Plaintext != "<Figure>" || d.PNG != "iVBORw0KGgo=" {
+		t.Fatalf("Known representations lost: %+v", d)
+	}
+	if _, ok := d.Extra["application/vnd.custom+json"]; !ok {
+		t.Fatalf("Unknown representation lost: %+v", d.Extra)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var want, got map[string]any
+	json.Unmarshal([]byte(bundle), &want)
+	json.Unmarshal(b, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("Round-trip mismatch:\nwant %v\n got %v", want, got)
+	}
+}
+
+func TestPlotly(t *testing.T) {
+	const fig = `{"data":[{"type":"bar","x":["a","b"],"y":[1,3]}],"layout":{"title":{"text":"bars"}}}`
+	content := `{
+		"data": {
+			"text/html": "<div id=\"plot\"></div>",
+			"application/vnd.plotly.v1+json": ` + fig + `
+		},
+		"metadata": {},
+		"transient": {}
+	}`
+
+	var c Content
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		t.Fatalf("Failed to unmarshal display_data: %v", err)
+	}
+	got, ok := c.Data.Plotly()
+	if !ok {
+		t.Fatal("Plotly figure not found")
+	}
+	var want, have any
+	json.Unmarshal([]byte(fig), &want)
+	json.Unmarshal(got, &have)
+	if !reflect.DeepEqual(want, have) {
+		t.Fatalf("Figure mismatch:\nwant %s\n got %s", fig, got)
+	}
+}
+
+func TestJSONValue(t *testing.T) {
+	const bundle = `{
+		"text/plain": "<IPython.core.display.JSON object>",
+		"application/json": {"answer": 42, "tags": ["a", "b"]}
+	}`
+
+	var d Data
+	if err := json.Unmarshal([]byte(bundle), &d); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	v, err := d.JSONValue()
+	if err != nil {
+		t.Fatalf("Failed to decode json data: %v", err)
+	}
+	want := map[string]any{"answer": 42.0, "tags": []any{"a", "b"}}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("Expected %v, got %v", want, v)
+	}
+	if s, ok := d.Get("application/json"); !ok || s != `{"answer": 42, "tags": ["a", "b"]}` {
+		t.Fatalf("Expected the JSON text, got %q", s)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var got map[string]any
+	json.Unmarshal(b, &got)
+	if !reflect.DeepEqual(got["application/json"], want) {
+		t.Fatalf("Expected the object marshalled back, got %s", b)
+	}
+
+	// as sent by the older kernels
+	d = Data{}
+	if err := json.Unmarshal([]byte(`{"application/json": "{\"answer\": 42}"}`), &d); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if d.JSON != `{"answer": 42}` {
+		t.Fatalf("Expected the JSON text, got %q", d.JSON)
+	}
+}
+
+func TestSanitizedHTML(t *testing.T) {
+	d := Data{HTML: `<table border="1" class="dataframe"><tr><td onclick="steal()">1</td></tr></table><script>alert(1)</script>`}
+	got, ok := d.SanitizedHTML(nil)
+	if !ok {
+		t.Fatal("Expected the HTML representation")
+	}
+	if want := `<table border="1" class="dataframe"><tr><td>1</td></tr></table>`; got != want {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+}
+
+// BenchmarkDecodeDisplay decodes the display_data of a plot off the wire,
+// as the read loop does, the message first, then its content. The decodes
+// per op are those that a replacement set with SetCodec takes over; to see
+// what one buys, benchstat the runs with it set, and without.
+func BenchmarkDecodeDisplay(b *testing.B) {
+	png := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\x89PNG\r\n", 128<<10)))
+	raw, err := json.Marshal(map[string]any{
+		"header":        map[string]any{"msg_id": "display", "msg_type": "display_data"},
+		"parent_header": map[string]any{"msg_id": "execute", "msg_type": "execute_request"},
+		"channel":       "iopub",
+		"msg_type":      "display_data",
+		"content": map[string]any{
+			"data":     map[string]any{"text/plain": "<Figure size 640x480 with 1 Axes>", "image/png": png},
+			"metadata": map[string]any{},
+		},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	cc := &counting{}
+	SetCodec(cc)
+	defer SetCodec(nil)
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	for b.Loop() {
+		var m Message
+		if err := codec.Get().Unmarshal(raw, &m); err != nil {
+			b.Fatal(err)
+		}
+		var content Content
+		if err := m.Unmarshal(&content); err != nil {
+			b.Fatal(err)
+		}
+		if content.Data == nil || content.Data.PNG == "" {
+			b.Fatal("Expected the image decoded")
+		}
+	}
+	b.ReportMetric(float64(cc.unmarshal.Load())/float64(b.N), "decodes/op")
+}
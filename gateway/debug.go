@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Debug sends the Debug Adapter Protocol request, e.g. setBreakpoints, or
+// stackTrace, over the control channel, and returns the DAP response.
+//
+// The request is of any type that encodes to the DAP JSON object; its seq,
+// and type, are filled in, if missing. The unsuccessful response is returned
+// along with the error. The DAP events arrive as the debug_event messages,
+// see Handle.
+func (k *Kernel) Debug(ctx context.Context, req any) (json.RawMessage, error) {
+	b, err := codec.Get().Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal debug request: %w", err)
+	}
+	var dap map[string]any
+	if err := codec.Get().Unmarshal(b, &dap); err != nil {
+		return nil, fmt.Errorf("debug request is not an object: %w", err)
+	}
+	if _, ok := dap["seq"]; !ok {
+		dap["seq"] = k.debugSeq.Add(1)
+	}
+	if _, ok := dap["type"]; !ok {
+		dap["type"] = "request"
+	}
+	command, _ := dap["command"].(string)
+
+	m, err := k.message("control", "debug_request", dap)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := k.request(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("debug %s: %w", command, err)
+	}
+	var resp struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := reply.Unmarshal(&resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal debug reply: %w", err)
+	}
+	if !resp.Success {
+		return reply.Content, fmt.Errorf("debug %s failed: %s", command, resp.Message)
+	}
+	return reply.Content, nil
+}
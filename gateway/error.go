@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/acarl005/stripansi"
+)
+
+type Error struct {
+	Ename     string   `json:"ename"`
+	Evalue    string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+
+	err error `json:"-"`
+}
+
+// ErrAborted is the error of the execution that was never completed, as it
+// was interrupted, or queued behind the one that failed.
+var ErrAborted = errors.New("execution aborted")
+
+// ErrorKind tells the exceptions raised by the code apart from the failures
+// to communicate with the kernel.
+type ErrorKind string
+
+const (
+	// KernelError is an exception raised in the kernel, see Ename.
+	KernelError ErrorKind = "kernel"
+	// TransportError is a failure of the connection, which may be retried.
+	TransportError ErrorKind = "transport"
+	// AbortedError is an execution aborted by the kernel, see ErrAborted.
+	AbortedError ErrorKind = "aborted"
+	// DiedError is an execution lost to the kernel dying, or restarting,
+	// see ErrKernelDied; unlike the transport errors, retrying it on the
+	// same kernel is futile, as its state is gone.
+	DiedError ErrorKind = "died"
+)
+
+// Kind of the error.
+func (e Error) Kind() ErrorKind {
+	switch {
+	case errors.Is(e.err, ErrAborted):
+		return AbortedError
+	case errors.Is(e.err, ErrKernelDied):
+		return DiedError
+	case e.err != nil:
+		return TransportError
+	}
+	return KernelError
+}
+
+// Unwrap returns the underlying transport error, if any.
+func (e Error) Unwrap() error {
+	return e.err
+}
+
+func (e Error) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Ename, e.Evalue)
+}
+
+func (e Error) String() string {
+	if e.err != nil {
+		return fmt.Sprintf("%+v", e.err)
+	}
+	var s strings.Builder
+	s.WriteString(e.Ename)
+	s.WriteString(": ")
+	s.WriteString(e.Evalue)
+	for _, tb := range e.Traceback {
+		s.WriteString("\n")
+		s.WriteString(stripansi.Strip(tb))
+	}
+	return s.String()
+}
+
+// MarshalJSON includes the underlying error, if any, as a string.
+func (e Error) MarshalJSON() ([]byte, error) {
+	type plain Error
+	v := struct {
+		plain
+		Err string `json:"err,omitempty"`
+	}{plain: plain(e)}
+	if e.err != nil {
+		v.Err = e.err.Error()
+	}
+	return codec.Get().Marshal(v)
+}
+
+// UnmarshalJSON restores the underlying error, if any, from its string.
+func (e *Error) UnmarshalJSON(b []byte) error {
+	type plain Error
+	var v struct {
+		plain
+		Err string `json:"err,omitempty"`
+	}
+	if err := codec.Get().Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*e = Error(v.plain)
+	switch v.Err {
+	case "":
+	case ErrAborted.Error():
+		e.err = ErrAborted
+	default:
+		if state, ok := strings.CutPrefix(v.Err, ErrKernelDied.Error()+": "); ok {
+			e.err = fmt.Errorf("%w: %s", ErrKernelDied, state)
+			break
+		}
+		e.err = errors.New(v.Err)
+	}
+	return nil
+}
+
+// Frame is a single entry of the traceback.
+type Frame struct {
+	File string
+	Line int
+	Func string
+	// Code is the source context of the frame, as printed.
+	Code []string
+}
+
+var (
+	// File "/path/to/file.py", line 12, in func; or without the function,
+	// as in File "<string>", line 1
+	pythonFrame = regexp.MustCompile(`^\s*File "(.+)", line (\d+)(?:, in (.+))?$`)
+	// File /path/to/file.py:12, in func(a, b)
+	ipythonFrame = regexp.MustCompile(`^File (.+):(\d+), in (.+)$`)
+	// Cell In[3], line 2; or Cell In[2], line 2, in f(), within a function
+	cellFrame = regexp.MustCompile(`^(Cell In\[\d+\]), line (\d+)(?:, in (.+))?$`)
+)
+
+// Frames parses the Python traceback, whether as formatted by IPython, or
+// the standard one, into structured entries, the innermost call last.
+func (e Error) Frames() []Frame {
+	var lines []string
+	for _, tb := range e.Traceback {
+		lines = append(lines, strings.Split(stripansi.Strip(tb), "\n")...)
+	}
+	var (
+		frames []Frame
+		f      *Frame
+	)
+	for _, line := range lines {
+		if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			frames = append(frames, Frame{File: m[1], Line: n, Func: m[3]})
+			f = &frames[len(frames)-1]
+			continue
+		}
+		if m := ipythonFrame.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			frames = append(frames, Frame{File: m[1], Line: n, Func: m[3]})
+			f = &frames[len(frames)-1]
+			continue
+		}
+		if m := cellFrame.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			frames = append(frames, Frame{File: m[1], Line: n, Func: m[3]})
+			f = &frames[len(frames)-1]
+			continue
+		}
+		switch {
+		case f == nil:
+		case strings.TrimSpace(line) == "":
+			f = nil
+		case e.Ename != "" && strings.HasPrefix(line, e.Ename):
+			// the final ExceptionType: message line
+			f = nil
+		default:
+			f.Code = append(f.Code, line)
+		}
+	}
+	return frames
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFrames(t *testing.T) {
+	ipython := Error{
+		Ename:  "ZeroDivisionError",
+		Evalue: "division by zero",
+		Traceback: []string{
+			"\x1b[0;31m---------------------------------------------------------------------------\x1b[0m",
+			"\x1b[0;31mZeroDivisionError\x1b[0m                         Traceback (most recent call last)",
+			"Cell \x1b[0;32mIn[3], line 2\x1b[0m\n\x1b[1;32m      1\x1b[0m x \x1b[38;5;241m=\x1b[39m \x1b[38;5;241m1\x1b[39m\n\x1b[0;32m----> 2\x1b[0m \x1b[43mf\x1b[49m\x1b[43m(\x1b[49m\x1b[43mx\x1b[49m\x1b[43m)\x1b[49m\n",
+			"File \x1b[0;32m/tmp/lib.py:7\x1b[0m, in \x1b[0;36mf\x1b[0;34m(x)\x1b[0m\n\x1b[0;32m----> 7\x1b[0m \x1b[38;5;28;01mreturn\x1b[39;00m x \x1b[38;5;241m/\x1b[39m \x1b[38;5;241m0\x1b[39m\n",
+			"\x1b[0;31mZeroDivisionError\x1b[0m: division by zero",
+		},
+	}
+	want := []Frame{
+		{File: "Cell In[3]", Line: 2, Code: []string{"      1 x = 1", "----> 2 f(x)"}},
+		{File: "/tmp/lib.py", Line: 7, Func: "f(x)", Code: []string{"----> 7 return x / 0"}},
+	}
+	if got := ipython.Frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected IPython frames %+v, got %+v", want, got)
+	}
+
+	python := Error{
+		Ename:  "KeyError",
+		Evalue: "'x'",
+		Traceback: []string{
+			"Traceback (most recent call last):",
+			`  File "main.py", line 3, in <module>`,
+			"    lookup({})",
+			`  File "main.py", line 2, in lookup`,
+			"    return d['x']",
+			"KeyError: 'x'",
+		},
+	}
+	want = []Frame{
+		{File: "main.py", Line: 3, Func: "<module>", Code: []string{"    lookup({})"}},
+		{File: "main.py", Line: 2, Func: "lookup", Code: []string{"    return d['x']"}},
+	}
+	if got := python.Frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected Python frames %+v, got %+v", want, got)
+	}
+
+	// IPython 8, raising in a function defined in a cell
+	nested := Error{
+		Ename:  "ValueError",
+		Evalue: "bad",
+		Traceback: []string{
+			"Cell \x1b[0;32mIn[3], line 1\x1b[0m\n\x1b[0;32m----> 1\x1b[0m f()\n",
+			"Cell \x1b[0;32mIn[2], line 2\x1b[0m, in \x1b[0;36mf\x1b[0;34m()\x1b[0m\n\x1b[1;32m      1\x1b[0m \x1b[38;5;28;01mdef\x1b[39;00m f():\n\x1b[0;32m----> 2\x1b[0m     \x1b[38;5;28;01mraise\x1b[39;00m \x1b[38;5;167;01mValueError\x1b[39;00m(\x1b[38;5;124m\"\x1b[39m\x1b[38;5;124mbad\x1b[39m\x1b[38;5;124m\"\x1b[39m)\n",
+			"\x1b[0;31mValueError\x1b[0m: bad",
+		},
+	}
+	want = []Frame{
+		{File: "Cell In[3]", Line: 1, Code: []string{"----> 1 f()"}},
+		{File: "Cell In[2]", Line: 2, Func: "f()", Code: []string{"      1 def f():", `----> 2     raise ValueError("bad")`}},
+	}
+	if got := nested.Frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the cell function frames %+v, got %+v", want, got)
+	}
+
+	// exec, or eval, of a string has no function
+	eval := Error{
+		Ename:  "NameError",
+		Evalue: "name 'y' is not defined",
+		Traceback: []string{
+			"Traceback (most recent call last):",
+			`  File "main.py", line 1, in <module>`,
+			"    eval('y')",
+			`  File "<string>", line 1`,
+			"NameError: name 'y' is not defined",
+		},
+	}
+	want = []Frame{
+		{File: "main.py", Line: 1, Func: "<module>", Code: []string{"    eval('y')"}},
+		{File: "<string>", Line: 1},
+	}
+	if got := eval.Frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the frame without the function %+v, got %+v", want, got)
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	c := Content{Error: &Error{err: errors.New("failed to read message: EOF")}}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var got Content
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if got.Error == nil || got.Error.Error() != "failed to read message: EOF" {
+		t.Fatalf("Expected the transport error to persist, got %s", b)
+	}
+
+	e := Error{Ename: "KeyError", Evalue: "'x'", Traceback: []string{}}
+	b, _ = json.Marshal(e)
+	if want := `{"ename":"KeyError","evalue":"'x'","traceback":[]}`; string(b) != want {
+		t.Fatalf("Expected %s, got %s", want, b)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	e := Error{err: fmt.Errorf("failed to read message: %w", io.ErrUnexpectedEOF)}
+	if e.Kind() != TransportError {
+		t.Errorf("Expected a transport error, got %s", e.Kind())
+	}
+	if !errors.Is(e, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected the underlying error unwrapped")
+	}
+	if e := (Error{Ename: "KeyError"}); e.Kind() != KernelError {
+		t.Errorf("Expected a kernel error, got %s", e.Kind())
+	}
+
+	e = Error{err: fmt.Errorf("%w: %s", ErrKernelDied, "dead")}
+	if e.Kind() != DiedError {
+		t.Errorf("Expected the kernel died, got %s", e.Kind())
+	}
+	b, _ := json.Marshal(e)
+	var got Error
+	if err := json.Unmarshal(b, &got); err != nil || got.Kind() != DiedError || got.Error() != "kernel died: dead" {
+		t.Errorf("Expected the kernel died to persist, got %s: %v", got.Kind(), got)
+	}
+}
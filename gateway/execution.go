@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// execution is the bookkeeping of a submitted execute_request.
+type execution struct {
+	submitted time.Time
+	state     string // queued, running, or the reply status
+	cancelled bool   // interrupt once it starts
+}
+
+// ErrKernelBusy is returned when the execution couldn't be submitted, as
+// the kernel has as many in flight as it allows.
+var ErrKernelBusy = errors.New("kernel is busy")
+
+// BusyPolicy decides what becomes of the execution submitted to the kernel
+// that is busy with another one.
+type BusyPolicy int
+
+const (
+	// OnBusyInterrupt interrupts the running execution first; the default.
+	OnBusyInterrupt BusyPolicy = iota
+	// OnBusyQueue leaves the execution to the kernel queue, to be run once
+	// the ones before it are done.
+	OnBusyQueue
+	// OnBusyReject fails with ErrKernelBusy, if the kernel is busy, or has
+	// any executions in flight.
+	OnBusyReject
+)
+
+// ExecuteOptions adjust the submission of the execution.
+type ExecuteOptions struct {
+	OnBusy BusyPolicy
+}
+
+// SetMaxConcurrency limits the executions in flight, i.e. submitted, and
+// not yet replied to; beyond the limit, the submissions block until there's
+// room, or fail with ErrKernelBusy once the context is done. The executions
+// are unlimited by default, or if n is not positive.
+func (k *Kernel) SetMaxConcurrency(n int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.limit = n
+	if k.changed != nil {
+		k.broadcast()
+	}
+}
+
+// admit registers the execution, once there's room for it.
+func (k *Kernel) admit(ctx context.Context, id uuid.UUID, x *execution) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for k.limit > 0 && len(k.executions) >= k.limit {
+		if k.closed {
+			return errClosed
+		}
+		changed := k.changed
+		k.mu.Unlock()
+		select {
+		case <-changed:
+			k.mu.Lock()
+		case <-ctx.Done():
+			k.mu.Lock()
+			return fmt.Errorf("%w: %w", ErrKernelBusy, ctx.Err())
+		}
+	}
+	x.submitted = time.Now()
+	k.executions[id] = x
+	return nil
+}
+
+// ExecuteHandle controls a single execution, as opposed to the kernel.
+type ExecuteHandle struct {
+	ID uuid.UUID
+	// Outputs is closed after the execute_reply, as in Execute.
+	Outputs <-chan *Content
+
+	k   *Kernel
+	x   *execution
+	sub *subscription
+}
+
+// Start submits the code, and returns the handle to the execution.
+func (k *Kernel) Start(ctx context.Context, code string) (*ExecuteHandle, error) {
+	return k.submit(ctx, code, nil)
+}
+
+// Status returns "queued", until the kernel starts the execution, then
+// "running", and finally the status of its reply: "ok", "error", or
+// "aborted"; should the kernel die meanwhile, it's "error".
+func (h *ExecuteHandle) Status() string {
+	h.k.mu.Lock()
+	defer h.k.mu.Unlock()
+	return h.x.state
+}
+
+// Cancel interrupts the execution, if it's running; if it's still queued,
+// it will be interrupted as soon as it starts, since the protocol provides
+// no means to withdraw a request. Finished executions are left alone.
+//
+// Note that the kernels, such as ipykernel, may abort the executions queued
+// after the interrupted one.
+func (h *ExecuteHandle) Cancel(ctx context.Context) error {
+	h.k.mu.Lock()
+	state := h.x.state
+	if state == "queued" {
+		h.x.cancelled = true
+	}
+	h.k.mu.Unlock()
+
+	if state != "running" {
+		return nil
+	}
+	return h.k.Interrupt(ctx)
+}
+
+// started marks the execution as running, once the kernel reports busy on
+// its behalf; the cancelled executions are interrupted right away.
+func (k *Kernel) started(id uuid.UUID) {
+	k.mu.Lock()
+	x, ok := k.executions[id]
+	if !ok || x.state != "queued" {
+		k.mu.Unlock()
+		return
+	}
+	x.state = "running"
+	cancelled := x.cancelled
+	k.mu.Unlock()
+
+	if cancelled {
+		// the read loop must not wait for the reply
+		go k.Interrupt(k.ctx)
+	}
+}
@@ -0,0 +1,300 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+)
+
+func TestExecuteHandle(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		switch code {
+		case "slow":
+			<-release
+		case "endless":
+			return gatewaytest.Reply{Delay: time.Minute}
+		}
+		return gatewaytest.Reply{}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	slow, err := k.Start(ctx, "slow")
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	endless, err := k.Start(ctx, "endless")
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if status := endless.Status(); status != "queued" {
+		t.Fatalf("Expected queued, got %s", status)
+	}
+	if err := endless.Cancel(ctx); err != nil {
+		t.Fatalf("Failed to cancel queued execution: %v", err)
+	}
+
+	close(release)
+	for range slow.Outputs {
+	}
+	if status := slow.Status(); status != "ok" {
+		t.Fatalf("Expected ok, got %s", status)
+	}
+	// interrupted as soon as it started
+	var last *Content
+	for last = range endless.Outputs {
+	}
+	if status := endless.Status(); status != "error" {
+		t.Fatalf("Expected the cancelled execution to fail, got %s", status)
+	}
+	if last.Error == nil || last.Error.Ename != "KeyboardInterrupt" {
+		t.Fatalf("Expected the execution interrupted, got %v", last.Error)
+	}
+	if err := slow.Cancel(ctx); err != nil {
+		t.Fatalf("Expected finished execution left alone, got %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	var handles []*ExecuteHandle
+	for range 3 {
+		h, err := k.Start(ctx, "x")
+		if err != nil {
+			t.Fatalf("Failed to start: %v", err)
+		}
+		handles = append(handles, h)
+	}
+	if err := k.Drain(ctx); err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+	for _, h := range handles {
+		if status := h.Status(); status != "ok" {
+			t.Fatalf("Expected finished execution, got %s", status)
+		}
+	}
+
+	k.Close()
+	if _, err := k.Start(ctx, "x"); err == nil {
+		t.Fatalf("Expected closed kernel to fail")
+	}
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	for _, code := range []string{"hello", "world!"} {
+		if _, err := k.Run(ctx, code, nil); err != nil {
+			t.Fatalf("Failed to run: %v", err)
+		}
+	}
+	s := k.Stats()
+	if s.Executions != 2 || s.Streamed != int64(len("helloworld!")) {
+		t.Fatalf("Expected 2 executions, and 11 bytes streamed, got %+v", s)
+	}
+	if s.Messages["execute_reply"] != 2 || s.Messages["stream"] != 2 {
+		t.Fatalf("Expected the messages counted by type, got %v", s.Messages)
+	}
+	if time.Since(s.LastActivity) > time.Second {
+		t.Fatalf("Expected recent activity, got %s", s.LastActivity)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		if code == "slow" {
+			<-release
+		}
+		return gatewaytest.Reply{}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	k.SetMaxConcurrency(1)
+
+	slow, err := k.Start(ctx, "slow")
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := k.Start(tctx, "fast"); !errors.Is(err, ErrKernelBusy) {
+		t.Fatalf("Expected the kernel busy, got %v", err)
+	}
+
+	admitted := make(chan *ExecuteHandle)
+	go func() {
+		h, err := k.Start(ctx, "fast")
+		if err != nil {
+			t.Errorf("Failed to start: %v", err)
+		}
+		admitted <- h
+	}()
+	select {
+	case <-admitted:
+		t.Fatal("Expected the execution to wait for the slow one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for range slow.Outputs {
+	}
+	fast := <-admitted
+	for range fast.Outputs {
+	}
+	if status := fast.Status(); status != "ok" {
+		t.Fatalf("Expected ok, got %s", status)
+	}
+}
+
+func TestOnBusy(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		if code == "slow" {
+			<-release
+		}
+		return gatewaytest.Reply{}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	slow, err := k.Execute(ctx, "slow")
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	_, err = k.ExecuteWith(ctx, "rejected", &ExecuteOptions{OnBusy: OnBusyReject})
+	if !errors.Is(err, ErrKernelBusy) {
+		t.Fatalf("Expected the kernel busy, got %v", err)
+	}
+	queued, err := k.ExecuteWith(ctx, "queued", &ExecuteOptions{OnBusy: OnBusyQueue})
+	if err != nil {
+		t.Fatalf("Failed to queue: %v", err)
+	}
+
+	close(release)
+	for _, ch := range []chan *Content{slow, queued} {
+		var c *Content
+		for c = range ch {
+		}
+		if c.Status != "ok" {
+			t.Fatalf("Expected ok, got %s", c.Status)
+		}
+	}
+}
+
+func TestExecuteFile(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	path := filepath.Join(t.TempDir(), "script.py")
+	os.WriteFile(path, []byte("\xef\xbb\xbfprint('hi')"), 0o644)
+	ch, err := k.ExecuteFile(ctx, path)
+	if err != nil {
+		t.Fatalf("Failed to execute file: %v", err)
+	}
+	var out []*Content
+	for c := range ch {
+		out = append(out, c)
+	}
+	if s := AssembleStream(out); s != "print('hi')" {
+		t.Fatalf("Expected the source sans the BOM, got %q", s)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := k.ExecuteReader(cancelled, strings.NewReader("1")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the read cancelled, got %v", err)
+	}
+}
+
+func TestDecodeSource(t *testing.T) {
+	for b, want := range map[string]string{
+		"x = 1":                   "x = 1",
+		"\xff\xfex\x00=\x001\x00": "x=1",
+		"\xfe\xff\x00x\x00=\x001": "x=1",
+		"\xef\xbb\xbf# ж":         "# ж",
+	} {
+		if got, err := decodeSource([]byte(b)); err != nil || got != want {
+			t.Errorf("Expected %q, got %q, %v", want, got, err)
+		}
+	}
+	if _, err := decodeSource([]byte("\xff")); err == nil {
+		t.Errorf("Expected the invalid UTF-8 rejected")
+	}
+}
+
+func TestDrainOnClose(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u, DrainOnClose: time.Second}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+
+	ch, err := k.Execute(ctx, "tail")
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	k.Close()
+	var last *Content
+	for c := range ch {
+		last = c
+	}
+	if last == nil || last.Type != "execute_reply" {
+		t.Fatalf("Expected the output drained up to the reply, got %v", last)
+	}
+}
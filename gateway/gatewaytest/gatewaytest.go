@@ -0,0 +1,223 @@
+// Package gatewaytest provides a fake Jupyter Enterprise Gateway for tests.
+//
+// The server implements just enough of the REST API, and the websocket
+// kernel protocol, for the gateway package to work against it: kernels can
+// be created, listed, interrupted, and shut down; the execute requests are
+// answered with status, stream, and execute_reply messages. The debug
+// requests succeed, except for the "unsupported" command.
+package gatewaytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reply is what the fake kernel outputs in response to an execute request.
+type Reply struct {
+	// Input, if set, is the prompt of the input requested before the
+	// outputs, provided the execution allows stdin; the answer is appended
+	// to stdout.
+	Input  string
+	Stdout string
+	// Chunks are streamed to stdout after the Stdout, one message each, as
+	// the code would print them along the way.
+	Chunks   []string
+	Displays []map[string]any // display_data MIME bundles
+	Result   map[string]any   // execute_result MIME bundle
+	Error    *Error
+	// Aborted replies with the "aborted" status instead, as the kernel
+	// does to the interrupted executions, or those queued behind an error.
+	Aborted bool
+	// Dies makes the kernel die after the outputs, reporting the "dead"
+	// status instead of the reply, as it does when, e.g., killed for OOM.
+	Dies bool
+	// Delay is how long the execution runs after its outputs; the shell
+	// requests queued behind it wait, while control is answered right away.
+	// Should the kernel be interrupted meanwhile, it raises KeyboardInterrupt.
+	Delay time.Duration
+}
+
+// Error is a Python exception raised by the fake kernel.
+type Error struct {
+	Ename     string
+	Evalue    string
+	Traceback []string
+}
+
+// Server is a fake gateway listening on a local loopback address.
+type Server struct {
+	*httptest.Server
+
+	// Exec produces the reply to the executed code. By default, the code
+	// is echoed to stdout.
+	Exec func(code string) Reply
+	// Unavailable fails the websocket upgrades to the kernel channels.
+	Unavailable bool
+	// Startup is how long the kernels take to start: until then, they are
+	// "starting", and only the control requests are answered.
+	Startup time.Duration
+
+	kernels  map[string]*kernel
+	received map[string]int // requests by type
+	mu       sync.Mutex
+}
+
+type kernel struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	ExecutionState string `json:"execution_state"`
+	LastActivity   string `json:"last_activity"`
+	Connections    int    `json:"connections"`
+
+	count      int
+	interrupts chan struct{}
+	ready      time.Time // once started, see Server.Startup
+}
+
+// NewServer starts and returns a new fake gateway.
+//
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Exec: func(code string) Reply {
+			return Reply{Stdout: code}
+		},
+		kernels:  make(map[string]*kernel),
+		received: make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/kernels", s.list)
+	mux.HandleFunc("POST /api/kernels", s.create)
+	mux.HandleFunc("GET /api/kernels/{id}", s.get)
+	mux.HandleFunc("DELETE /api/kernels/{id}", s.delete)
+	mux.HandleFunc("POST /api/kernels/{id}/interrupt", s.interrupt)
+	mux.HandleFunc("POST /api/kernels/{id}/restart", s.restart)
+	mux.HandleFunc("GET /api/kernels/{id}/channels", s.channels)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Kernels returns the ids of the running kernels.
+func (s *Server) Kernels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.kernels))
+	for id := range s.kernels {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Received returns the number of the requests of the type, e.g.
+// "shutdown_request", received on any of the channels.
+func (s *Server) Received(msgType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received[msgType]
+}
+
+func (s *Server) kernel(w http.ResponseWriter, r *http.Request) *kernel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.kernels[r.PathValue("id")]
+	if !ok {
+		http.Error(w, `{"reason":"Not Found","message":"Kernel does not exist"}`, http.StatusNotFound)
+		return nil
+	}
+	return k
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	kernels := make([]*kernel, 0, len(s.kernels))
+	for _, k := range s.kernels {
+		kernels = append(kernels, k)
+	}
+	sort.Slice(kernels, func(i, j int) bool {
+		return kernels[i].ID < kernels[j].ID
+	})
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, kernels)
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		body.Name = "python3"
+	}
+	k := &kernel{
+		ID:             uuid.NewString(),
+		Name:           body.Name,
+		ExecutionState: "starting",
+		LastActivity:   time.Now().UTC().Format(time.RFC3339),
+		interrupts:     make(chan struct{}, 1),
+		ready:          time.Now().Add(s.Startup),
+	}
+	s.mu.Lock()
+	s.kernels[k.ID] = k
+	s.mu.Unlock()
+	// as the gateways behind the session affinity do
+	http.SetCookie(w, &http.Cookie{Name: "gateway_session", Value: k.ID, Path: "/"})
+	writeJSON(w, http.StatusCreated, k)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	if k := s.kernel(w, r); k != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, k)
+	}
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	if k := s.kernel(w, r); k != nil {
+		s.mu.Lock()
+		delete(s.kernels, k.ID)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) interrupt(w http.ResponseWriter, r *http.Request) {
+	if k := s.kernel(w, r); k != nil {
+		k.interrupt()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// interrupt raises KeyboardInterrupt in the running execution, if any.
+func (k *kernel) interrupt() {
+	select {
+	case k.interrupts <- struct{}{}:
+	default:
+	}
+}
+
+// restart starts the execution count over, as a restarted kernel would.
+func (s *Server) restart(w http.ResponseWriter, r *http.Request) {
+	if k := s.kernel(w, r); k != nil {
+		s.mu.Lock()
+		k.count = 0
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, k)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,316 @@
+package gatewaytest
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type header struct {
+	ID       string    `json:"msg_id,omitempty"`
+	Type     string    `json:"msg_type,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Session  string    `json:"session,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	Date     time.Time `json:"date,omitzero"`
+}
+
+type message struct {
+	Header       header         `json:"header"`
+	ParentHeader header         `json:"parent_header"`
+	Channel      string         `json:"channel"`
+	ID           string         `json:"msg_id"`
+	Type         string         `json:"msg_type"`
+	Content      map[string]any `json:"content"`
+	Metadata     map[string]any `json:"metadata"`
+	Buffers      []any          `json:"buffers"`
+}
+
+// session is a single websocket connection to a kernel.
+type session struct {
+	*Server
+	kernel *kernel
+	conn   *websocket.Conn
+	wmu    sync.Mutex
+	shell  chan *message // queued requests, see serve
+	stdin  chan *message // input replies
+	done   chan struct{} // closed once the connection is
+}
+
+var errClosed = errors.New("connection closed")
+
+// upgrader allows any origin, as the gateway configured with allow_origin '*'.
+var upgrader = websocket.Upgrader{
+	EnableCompression: true,
+	CheckOrigin:       func(*http.Request) bool { return true },
+}
+
+func (s *Server) channels(w http.ResponseWriter, r *http.Request) {
+	k := s.kernel(w, r)
+	if k == nil {
+		return
+	}
+	if s.Unavailable {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sess := &session{
+		Server: s,
+		kernel: k,
+		conn:   conn,
+		shell:  make(chan *message, 64),
+		stdin:  make(chan *message, 1),
+		done:   make(chan struct{}),
+	}
+	defer close(sess.done)
+	go sess.serve()
+	defer close(sess.shell)
+	for {
+		var m message
+		if err := conn.ReadJSON(&m); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.received[m.Header.Type]++
+		s.mu.Unlock()
+		switch m.Channel {
+		case "control":
+			if err := sess.handle(&m); err != nil {
+				return
+			}
+		case "stdin":
+			select {
+			case sess.stdin <- &m:
+			default:
+			}
+		default:
+			sess.shell <- &m
+		}
+	}
+}
+
+// serve handles the shell requests in order, one at a time, as the kernel
+// does, once it has started, while the control requests are handled as they
+// arrive.
+func (s *session) serve() {
+	select {
+	case <-time.After(time.Until(s.kernel.ready)):
+		if err := s.status(header{}, "idle"); err != nil {
+			s.conn.Close()
+		}
+	case <-s.done:
+	}
+	for m := range s.shell {
+		if err := s.handle(m); err != nil {
+			s.conn.Close()
+			break
+		}
+	}
+	for range s.shell {
+	}
+}
+
+func (s *session) handle(m *message) error {
+	switch m.Header.Type {
+	case "execute_request":
+		code, _ := m.Content["code"].(string)
+		stdin, _ := m.Content["allow_stdin"].(bool)
+		return s.execute(m.Header, code, stdin)
+	case "kernel_info_request":
+		return s.reply(m, "kernel_info_reply", map[string]any{
+			"status":           "ok",
+			"protocol_version": "5.3",
+			"implementation":   "gatewaytest",
+			"language_info": map[string]any{
+				"name":           "python",
+				"file_extension": ".py",
+			},
+		})
+	case "debug_request":
+		command, _ := m.Content["command"].(string)
+		return s.reply(m, "debug_reply", map[string]any{
+			"type":        "response",
+			"request_seq": m.Content["seq"],
+			"command":     command,
+			"success":     command != "unsupported",
+			"body":        map[string]any{},
+		})
+	case "interrupt_request":
+		s.kernel.interrupt()
+		return s.reply(m, "interrupt_reply", map[string]any{"status": "ok"})
+	case "shutdown_request":
+		return s.reply(m, "shutdown_reply", map[string]any{
+			"status":  "ok",
+			"restart": m.Content["restart"] == true,
+		})
+	}
+	return nil
+}
+
+func (s *session) execute(parent header, code string, stdin bool) error {
+	s.mu.Lock()
+	s.kernel.count++
+	count := s.kernel.count
+	s.mu.Unlock()
+
+	reply := s.Exec(code)
+	// the interrupts that came while idle are lost, as they are on the kernel
+	select {
+	case <-s.kernel.interrupts:
+	default:
+	}
+	if err := s.status(parent, "busy"); err != nil {
+		return err
+	}
+	if reply.Input != "" && stdin {
+		err := s.send(parent, "stdin", "input_request", map[string]any{
+			"prompt":   reply.Input,
+			"password": false,
+		})
+		if err != nil {
+			return err
+		}
+		var m *message
+		select {
+		case m = <-s.stdin:
+		case <-s.done:
+			return errClosed
+		}
+		if value, ok := m.Content["value"].(string); ok && m.Header.Type == "input_reply" {
+			reply.Stdout += value
+		}
+	}
+	if reply.Stdout != "" {
+		err := s.send(parent, "iopub", "stream", map[string]any{
+			"name": "stdout",
+			"text": reply.Stdout,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, chunk := range reply.Chunks {
+		err := s.send(parent, "iopub", "stream", map[string]any{
+			"name": "stdout",
+			"text": chunk,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, data := range reply.Displays {
+		err := s.send(parent, "iopub", "display_data", map[string]any{
+			"data":     data,
+			"metadata": map[string]any{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if reply.Result != nil {
+		err := s.send(parent, "iopub", "execute_result", map[string]any{
+			"execution_count": count,
+			"data":            reply.Result,
+			"metadata":        map[string]any{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	select {
+	case <-time.After(reply.Delay):
+	case <-s.kernel.interrupts:
+		reply.Error = &Error{Ename: "KeyboardInterrupt"}
+		reply.Dies = false
+	case <-s.done:
+		return errClosed
+	}
+	if reply.Dies {
+		return s.status(parent, "dead")
+	}
+	content := map[string]any{
+		"status":          "ok",
+		"execution_count": count,
+	}
+	if e := reply.Error; e != nil {
+		traceback := e.Traceback
+		if traceback == nil {
+			traceback = []string{}
+		}
+		exc := map[string]any{
+			"ename":     e.Ename,
+			"evalue":    e.Evalue,
+			"traceback": traceback,
+		}
+		if err := s.send(parent, "iopub", "error", exc); err != nil {
+			return err
+		}
+		content = exc
+		content["status"] = "error"
+		content["execution_count"] = count
+	}
+	if reply.Aborted {
+		content = map[string]any{"status": "aborted"}
+	}
+	if err := s.send(parent, "shell", "execute_reply", content); err != nil {
+		return err
+	}
+	return s.status(parent, "idle")
+}
+
+func (s *session) reply(m *message, msgType string, content map[string]any) error {
+	channel := m.Channel
+	if channel == "" {
+		channel = "shell"
+	}
+	if err := s.status(m.Header, "busy"); err != nil {
+		return err
+	}
+	if err := s.send(m.Header, channel, msgType, content); err != nil {
+		return err
+	}
+	return s.status(m.Header, "idle")
+}
+
+func (s *session) status(parent header, state string) error {
+	s.mu.Lock()
+	s.kernel.ExecutionState = state
+	s.kernel.LastActivity = time.Now().UTC().Format(time.RFC3339)
+	s.mu.Unlock()
+	return s.send(parent, "iopub", "status", map[string]any{
+		"execution_state": state,
+	})
+}
+
+func (s *session) send(parent header, channel, msgType string, content map[string]any) error {
+	h := header{
+		ID:       uuid.NewString(),
+		Type:     msgType,
+		Username: "gatewaytest",
+		Session:  s.kernel.ID,
+		Version:  "5.3",
+		Date:     time.Now().UTC(),
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.conn.WriteJSON(&message{
+		Header:       h,
+		ParentHeader: parent,
+		Channel:      channel,
+		ID:           h.ID,
+		Type:         msgType,
+		Content:      content,
+		Metadata:     map[string]any{},
+		Buffers:      []any{},
+	})
+}
@@ -2,98 +2,301 @@ package gateway
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/acarl005/stripansi"
+	"github.com/busthorne/cablectl/backoff"
 	"github.com/busthorne/cablectl/gateway/api"
+	"github.com/busthorne/cablectl/internal/useragent"
 	"github.com/crackcomm/go-jupyter/jupyter"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// defaultProtocol is assumed until the kernel reports its own.
+const defaultProtocol = "5.0"
+
+// defaultHandshakeTimeout is the default Kernel.HandshakeTimeout.
+const defaultHandshakeTimeout = 30 * time.Second
+
+// ErrHandshakeTimeout is returned when the gateway doesn't complete
+// the websocket upgrade in time.
+var ErrHandshakeTimeout = errors.New("kernel handshake timed out")
+
+// ErrHandshakeRejected is returned when the gateway turns the websocket
+// upgrade down for good, e.g. with 404, as it culled the kernel, or with 403;
+// Reconnect gives up on it, rather than retrying.
+var ErrHandshakeRejected = errors.New("kernel handshake rejected")
+
+// controlTimeout is how long to wait for a reply on the control channel,
+// before falling back to the REST API.
+const controlTimeout = 5 * time.Second
+
 type Kernel struct {
-	ID        uuid.UUID
-	Name      string
+	ID   uuid.UUID
+	Name string
+	// Session identifies the client in the message headers, and to the
+	// gateway on the websocket; it's generated by NewKernel, if empty, and
+	// kept across Reconnect, so that the kernel correlates the messages.
 	Session   string
 	User      string
 	Status    string
 	KeepAlive time.Duration
 	Client    *api.Client
 	URL       *url.URL
+	Metrics   Metrics
+
+	// BufferSize is the capacity of the output channel, defaults to 64.
+	BufferSize int
+	// DropOldest makes the read loop never block on a slow consumer: when
+	// the output buffer is full, the oldest content is discarded instead.
+	DropOldest bool
+	// Binary requests the v1 binary websocket subprotocol; if the server
+	// doesn't accept it, the messages are sent as JSON.
+	Binary bool
+	// Compression negotiates permessage-deflate with the gateway, which
+	// pays off for the image-heavy outputs over remote connections.
+	Compression bool
+	// HandshakeTimeout limits the websocket upgrade, so that an unresponsive
+	// gateway wouldn't hang NewKernel; defaults to 30 seconds.
+	HandshakeTimeout time.Duration
+	// Jar is shared by the REST client, and the websocket dialer, so that
+	// the session cookies set by the gateway are replayed on the upgrade.
+	// If you provide your own Client, make sure it uses the same jar.
+	Jar http.CookieJar
+	// WSHeaders are sent with the websocket upgrade request, along with
+	// the Origin, if set; authenticating reverse proxies may require them.
+	WSHeaders http.Header
+	Origin    string
+	// UserAgent is sent with the REST, and websocket, requests; defaults
+	// to cablectl/<version>. Your own Client has to set it on its own.
+	UserAgent string
+	// StatusUpdates makes the kernel status changes delivered as content,
+	// with State set, along with the outputs.
+	StatusUpdates bool
+	// AllowStdin lets the executions prompt for input: the input_request
+	// contents are delivered on the stdin channel, and answered with Input.
+	AllowStdin bool
+	// GracefulShutdown makes Shutdown send shutdown_request, and wait for
+	// the reply, before deleting the kernel through the REST API.
+	GracefulShutdown bool
+	// ReuseExisting makes NewKernel attach to a running kernel of the same
+	// name, if there is one on the gateway, instead of creating a new one.
+	ReuseExisting bool
+	// BaseContext is the parent of the connection lifecycle, i.e. the read
+	// loop, and keepalive, which otherwise only stop on Close. It defaults
+	// to the context of NewKernel, without its cancellation.
+	BaseContext context.Context
+	// Backoff paces the attempts of Reconnect; defaults to backoff.Default.
+	Backoff backoff.Backoff
+	// DrainOnClose makes Close wait, for up to the duration, until the
+	// executions in flight are done, so that their outputs aren't cut off.
+	DrainOnClose time.Duration
+	// Init is the preamble, i.e. the imports, and helpers, run by NewKernel
+	// in order, once the kernel it creates is connected; should any of the
+	// cells fail, so does NewKernel.
+	Init []string
+	// MarkdownRenderer, if set, renders the text/markdown representations
+	// before they are delivered, i.e. for the terminal.
+	MarkdownRenderer func(markdown string) string
 
 	in     chan string
 	out    chan *Content
 	conn   *websocket.Conn
+	v1     bool // negotiated binary subprotocol
+	wmu    sync.Mutex
+	ctx    context.Context // connection lifecycle
 	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	protocol   string                   // negotiated protocol version
+	changed    chan struct{}            // closed, and replaced on every update, see broadcast
+	pending    map[string]chan *Message // awaited replies by request id
+	control    map[string]bool          // control requests until their idle, see handle
+	executions map[uuid.UUID]*execution // in flight
+	input      *Header                  // awaiting input_reply
+	tails      map[streamKey][]byte     // incomplete runes, see complete
+	count      int                      // highest execution count seen
+	onStatus   []func(state string)
+	onDied     []func(state string)
+	handlers   map[string]func(*Message) // by type, see Handle
+	limit      int                       // executions in flight, see SetMaxConcurrency
+	subs       []*subscription
+	// listening is set once the out channel is subscribed by Listen,
+	// and closed is set once the read loop stops.
+	listening, closed bool
+	dropped           atomic.Int64
+	debugSeq          atomic.Int64
+	stats             stats
 }
 
 // New attaches a websocket connection to a new, or existing, kernel.
-func NewKernel(ctx context.Context, k *Kernel) error {
-	switch {
-	case k.Name == "":
+//
+// The context bounds the whole setup, i.e. creating the kernel, dialing
+// its websocket, and running the Init; should any fail, the kernel created
+// along the way is shut down. Once connected, the context no longer matters.
+func NewKernel(ctx context.Context, k *Kernel) (err error) {
+	if k.Jar == nil {
+		k.Jar, _ = cookiejar.New(nil)
+	}
+	if k.Name == "" {
 		return fmt.Errorf("kernel name is required")
-	case k.Client == nil:
-		if k.URL.String() == "" {
-			return fmt.Errorf("kernel gateway url is required")
+	}
+	u, err := gatewayURL(k.URL)
+	if err != nil {
+		return err
+	}
+	k.URL = u
+	if k.Session == "" {
+		k.Session = uuid.NewString()
+	}
+	if k.UserAgent == "" {
+		k.UserAgent = useragent.Default
+	}
+	if k.Client == nil {
+		ua := func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("User-Agent", k.UserAgent)
+			return nil
 		}
-		gw, err := api.NewClient(k.URL.String())
+		gw, err := api.NewClient(k.URL.String(),
+			api.WithHTTPClient(&http.Client{Jar: k.Jar}),
+			api.WithRequestEditorFn(ua))
 		if err != nil {
 			return fmt.Errorf("failed to create gateway client: %w", err)
 		}
 		k.Client = gw
 	}
 
-	if k.ID == uuid.Nil {
-		resp, err := k.Client.PostApiKernels(ctx, api.PostApiKernelsJSONRequestBody{
-			Name: &k.Name,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create kernel: %w", err)
+	if k.ID == uuid.Nil && k.ReuseExisting {
+		if err := k.find(ctx); err != nil {
+			return err
 		}
-		var kl api.Kernel
-		if err := json.NewDecoder(resp.Body).Decode(&kl); err != nil {
-			return fmt.Errorf("failed to unmarshal kernel: %w", err)
+	}
+	created := k.ID == uuid.Nil
+	if created {
+		if err := k.create(ctx); err != nil {
+			return err
 		}
-		defer resp.Body.Close()
+		defer func() {
+			if err != nil {
+				k.discard(ctx)
+			}
+		}()
+	}
 
-		k.ID = kl.Id
-		if state := kl.ExecutionState; state != nil {
-			k.Status = *state
+	if k.HandshakeTimeout == 0 {
+		k.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	dialer := websocket.Dialer{
+		Jar:               k.Jar,
+		EnableCompression: k.Compression,
+		HandshakeTimeout:  k.HandshakeTimeout,
+	}
+	if k.Binary {
+		dialer.Subprotocols = []string{Subprotocol}
+	}
+	ws := k.channels()
+	header := k.WSHeaders.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if k.Origin != "" {
+		header.Set("Origin", k.Origin)
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", k.UserAgent)
+	}
+	// the dialer only honours the context deadline during the handshake,
+	// so the connection is interrupted, should the context be cancelled
+	var stop func() bool
+	dialer.NetDialContext = func(dctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(dctx, network, addr)
+		if err != nil {
+			return nil, err
 		}
+		stop = context.AfterFunc(ctx, func() {
+			conn.SetDeadline(time.Unix(1, 0))
+		})
+		return conn, nil
 	}
-
-	dialer := websocket.Dialer{}
-	// TODO: URL without schema
-	ws := fmt.Sprintf("ws://%s/api/kernels/%s/channels",
-		k.URL.Host,
-		k.ID)
-	conn, _, err := dialer.Dial(ws, http.Header{})
-	if err != nil {
+	conn, resp, err := dialer.DialContext(ctx, ws, header)
+	if stop != nil {
+		stop()
+	}
+	// the dialer times out the connection on the context deadline, which
+	// may happen moments before the context reports it
+	if dl, ok := ctx.Deadline(); ok && err != nil && !time.Now().Before(dl) {
+		<-ctx.Done()
+	}
+	switch ne, _ := err.(net.Error); {
+	case ctx.Err() != nil:
+		if conn != nil {
+			conn.Close()
+		}
+		return fmt.Errorf("failed to dial kernel: %w", ctx.Err())
+	case ne != nil && ne.Timeout():
+		return fmt.Errorf("%w after %s: %w", ErrHandshakeTimeout, k.HandshakeTimeout, err)
+	case err != nil && resp != nil && rejected(resp.StatusCode):
+		return fmt.Errorf("failed to dial kernel: %w: %s", ErrHandshakeRejected, resp.Status)
+	case err != nil:
 		return fmt.Errorf("failed to dial kernel: %w", err)
 	}
 	k.conn = conn
-	ctx, k.cancel = context.WithCancel(ctx)
+	k.v1 = conn.Subprotocol() == Subprotocol
+	base := k.BaseContext
+	if base == nil {
+		base = context.WithoutCancel(ctx)
+	}
+	k.ctx, k.cancel = context.WithCancel(base)
 
 	if k.in == nil {
 		k.in = make(chan string, 1)
 	}
+	if k.BufferSize == 0 {
+		k.BufferSize = 64
+	}
 	if k.out == nil {
-		k.out = make(chan *Content, 1)
+		k.out = make(chan *Content, k.BufferSize)
+	}
+	k.changed = make(chan struct{})
+	k.pending = make(map[string]chan *Message)
+	k.control = make(map[string]bool)
+	k.executions = make(map[uuid.UUID]*execution)
+	k.subs = nil
+	k.listening = false
+	k.closed = false
+	k.protocol = ""
+	k.tails = nil
+	if created {
+		// kept across Reconnect, so that a restart meanwhile is detected
+		k.count = 0
 	}
 
-	go k.read(ctx)
+	go k.read(k.ctx, conn)
+	k.negotiate(ctx)
+	if created {
+		if err := k.preamble(ctx); err != nil {
+			k.Close()
+			return err
+		}
+	}
 
 	if k.KeepAlive == 0 {
 		return nil
 	}
 	// keepalive
+	ctx = k.ctx
 	go func() {
 		ticker := time.NewTicker(k.KeepAlive)
 		defer ticker.Stop()
@@ -102,15 +305,11 @@ func NewKernel(ctx context.Context, k *Kernel) error {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if k.conn == nil {
-					return
-				}
-				err := k.conn.WriteMessage(websocket.PingMessage, nil)
+				deadline := time.Now().Add(k.KeepAlive)
+				err := conn.WriteControl(websocket.PingMessage, nil, deadline)
 				if err != nil {
-					k.out <- &Content{
-						Error: &Error{err: err},
-					}
-					k.Close()
+					// the read loop will fail, and report it
+					conn.Close()
 					return
 				}
 			}
@@ -119,22 +318,378 @@ func NewKernel(ctx context.Context, k *Kernel) error {
 	return nil
 }
 
-// Listen returns a combined stdout/stderr stream.
+// rejected tells whether the response to the upgrade is not worth retrying,
+// i.e. a client error, other than the timeout, or the rate limit.
+func rejected(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500
+}
+
+// gatewayURL validates the gateway URL, and returns its normalized copy,
+// sans the trailing slash; the URL without a scheme is taken for http.
+func gatewayURL(u *url.URL) (*url.URL, error) {
+	if u == nil || u.String() == "" {
+		return nil, fmt.Errorf("kernel gateway url is required")
+	}
+	v := *u
+	// localhost:8888 parses as the scheme "localhost", and opaque "8888"
+	if _, err := strconv.Atoi(v.Opaque); v.Scheme == "" || err == nil {
+		w, err := url.Parse("http://" + u.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid kernel gateway url %q: %w", u, err)
+		}
+		v = *w
+	}
+	switch v.Scheme {
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported kernel gateway url scheme %q, want http, or https", v.Scheme)
+	}
+	if v.Host == "" {
+		return nil, fmt.Errorf("kernel gateway url %q has no host", u)
+	}
+	v.Path = strings.TrimRight(v.Path, "/")
+	v.RawPath = strings.TrimRight(v.RawPath, "/")
+	return &v, nil
+}
+
+// channels is the websocket URL of the kernel, under the gateway path.
+func (k *Kernel) channels() string {
+	u := url.URL{
+		Scheme: "ws",
+		Host:   k.URL.Host,
+		Path:   strings.TrimSuffix(k.URL.Path, "/") + "/api/kernels/" + k.ID.String() + "/channels",
+	}
+	if k.URL.Scheme == "https" || k.URL.Scheme == "wss" {
+		u.Scheme = "wss"
+	}
+	if k.Session != "" {
+		u.RawQuery = url.Values{"session_id": {k.Session}}.Encode()
+	}
+	return u.String()
+}
+
+// preamble runs the Init cells, queued behind whatever the kernel is doing
+// as it starts up.
+func (k *Kernel) preamble(ctx context.Context) error {
+	for i, code := range k.Init {
+		h, err := k.submit(ctx, code, &ExecuteOptions{OnBusy: OnBusyQueue})
+		if err != nil {
+			return fmt.Errorf("init cell %d: %w", i, err)
+		}
+		var reply *Content
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				k.abandon(h.sub)
+				return fmt.Errorf("init cell %d: %w", i, ctx.Err())
+			case c, ok := <-h.sub.ch:
+				if !ok {
+					break wait
+				}
+				reply = c
+			}
+		}
+		switch {
+		case reply == nil || reply.Type != "execute_reply":
+			return fmt.Errorf("init cell %d: %w", i, errClosed)
+		case reply.Error != nil:
+			return fmt.Errorf("init cell %d: %w", i, reply.Error)
+		}
+	}
+	return nil
+}
+
+// NewKernelTimeout is NewKernel, giving up on the setup after d.
+func NewKernelTimeout(ctx context.Context, k *Kernel, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	return NewKernel(ctx, k)
+}
+
+func (k *Kernel) create(ctx context.Context) error {
+	resp, err := k.Client.PostApiKernels(ctx, api.PostApiKernelsJSONRequestBody{
+		Name: &k.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create kernel: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to create kernel: %s", resp.Status)
+	}
+	var kl api.Kernel
+	if err := json.NewDecoder(resp.Body).Decode(&kl); err != nil {
+		return fmt.Errorf("failed to unmarshal kernel: %w", err)
+	}
+
+	k.ID = kl.Id
+	if state := kl.ExecutionState; state != nil {
+		k.Status = *state
+	}
+	k.metrics().KernelCreated(k.Name)
+	return nil
+}
+
+// discard shuts down the kernel that was created, but never connected to.
+func (k *Kernel) discard(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), controlTimeout)
+	defer cancel()
+	resp, err := k.Client.DeleteApiKernelsKernelId(ctx, k.ID)
+	if err == nil {
+		resp.Body.Close()
+	}
+	k.ID = uuid.Nil
+}
+
+// find looks up a running kernel by name.
+func (k *Kernel) find(ctx context.Context) error {
+	resp, err := k.Client.GetApiKernels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list kernels: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to list kernels: %s", resp.Status)
+	}
+	var kernels []api.Kernel
+	if err := json.NewDecoder(resp.Body).Decode(&kernels); err != nil {
+		return fmt.Errorf("failed to unmarshal kernels: %w", err)
+	}
+	for _, kl := range kernels {
+		if kl.Name != k.Name {
+			continue
+		}
+		k.ID = kl.Id
+		if state := kl.ExecutionState; state != nil {
+			k.Status = *state
+		}
+		return nil
+	}
+	return nil
+}
+
+// Listen returns a combined stream of all contents.
+//
+// The contents are only delivered once Listen is called, so as not to
+// block the read loop when nobody's listening. The channel is closed along
+// with the connection.
 func (k *Kernel) Listen() <-chan *Content {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.listening && !k.closed {
+		k.listening = true
+		k.subs = append(k.subs, &subscription{ch: k.out})
+	}
 	return k.out
 }
 
+// WaitReady blocks until the kernel reports idle status.
+//
+// The kernel may still be starting when NewKernel returns, so it's a good
+// idea to wait for it before the first execution. The status on behalf of
+// the control requests, which the kernel may answer as it starts up, such
+// as those of Alive, doesn't count.
+func (k *Kernel) WaitReady(ctx context.Context) error {
+	for {
+		k.mu.Lock()
+		status, changed := k.Status, k.changed
+		k.mu.Unlock()
+		if status == "idle" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Drain blocks until all of the submitted executions have finished, and the
+// kernel is idle, so that all of their outputs have been received.
+func (k *Kernel) Drain(ctx context.Context) error {
+	for {
+		k.mu.Lock()
+		pending, status, closed := len(k.executions), k.Status, k.closed
+		changed := k.changed
+		k.mu.Unlock()
+		switch {
+		case pending == 0 && status == "idle":
+			return nil
+		case closed:
+			return errClosed
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Info requests the kernel_info_reply from the kernel.
+func (k *Kernel) Info(ctx context.Context) (*KernelInfo, error) {
+	return k.info(ctx, "shell")
+}
+
+// info sends kernel_info_request on the channel; over control, it's not
+// queued behind the running execution.
+func (k *Kernel) info(ctx context.Context, channel string) (*KernelInfo, error) {
+	m, err := k.message(channel, "kernel_info_request", map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := k.request(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("kernel info: %w", err)
+	}
+	var info KernelInfo
+	if err := reply.Unmarshal(&info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal kernel info: %w", err)
+	}
+	return &info, nil
+}
+
+// negotiate adopts the protocol version that the kernel reports, if it
+// replies in time; otherwise, the default version is used.
+//
+// It's asked over control, so that connecting to a busy kernel isn't held
+// up by the execution.
+func (k *Kernel) negotiate(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+	defer cancel()
+	info, err := k.info(ctx, "control")
+	if err != nil || info.ProtocolVersion == "" {
+		return
+	}
+	k.mu.Lock()
+	k.protocol = info.ProtocolVersion
+	k.mu.Unlock()
+}
+
+// Protocol returns the messaging protocol version used in the headers.
+func (k *Kernel) Protocol() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.protocol == "" {
+		return defaultProtocol
+	}
+	return k.protocol
+}
+
+// Alive reports whether the kernel replies to kernel_info_request in time.
+//
+// Unlike the websocket pings, which only prove the connection is alive, this
+// tells apart a hung kernel. The request is sent over the control channel, so
+// that a long execution doesn't pass for a hang. Unless the context has a
+// deadline, the kernel has ten seconds to reply.
+func (k *Kernel) Alive(ctx context.Context) bool {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	_, err := k.info(ctx, "control")
+	return err == nil
+}
+
+// Dropped returns the number of contents discarded in DropOldest mode.
+func (k *Kernel) Dropped() int64 {
+	return k.dropped.Load()
+}
+
 // Interrupt stops the current kernel execution, & makes way for a new one.
+//
+// The interrupt_request is sent over the control channel, so that it's not
+// queued behind the running execution; if the kernel doesn't reply in time,
+// it's interrupted through the REST API instead.
 func (k *Kernel) Interrupt(ctx context.Context) error {
-	resp, err := k.Client.PostKernelsKernelIdInterrupt(ctx, k.ID)
+	if k.connected() {
+		m, err := k.message("control", "interrupt_request", map[string]any{})
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+		_, err = k.request(ctx, m)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+
+	resp, err := k.Client.PostApiKernelsKernelIdInterrupt(ctx, k.ID)
 	if err != nil {
 		return fmt.Errorf("failed to interrupt: %w", err)
 	}
-	return resp.Body.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to interrupt: %s", resp.Status)
+	}
+	return nil
+}
+
+// InterruptWait interrupts the kernel, and blocks until the executions it
+// interrupted are replied to; should none of those submitted here be running,
+// e.g. as the kernel is busy with another client, until the kernel is idle.
+func (k *Kernel) InterruptWait(ctx context.Context) error {
+	k.mu.Lock()
+	var running []uuid.UUID
+	for id, x := range k.executions {
+		if x.state == "running" {
+			running = append(running, id)
+		}
+	}
+	k.mu.Unlock()
+	if err := k.Interrupt(ctx); err != nil {
+		return err
+	}
+	if len(running) == 0 {
+		return k.WaitReady(ctx)
+	}
+	for {
+		k.mu.Lock()
+		done := !slices.ContainsFunc(running, func(id uuid.UUID) bool {
+			return k.executions[id] != nil
+		})
+		closed, changed := k.closed, k.changed
+		k.mu.Unlock()
+		switch {
+		case done:
+			return nil
+		case closed:
+			return errClosed
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
 }
 
 // Shutdown kills the kernel, & releases the resources associated with it.
+//
+// With GracefulShutdown, the kernel is first asked to shut down over the
+// control channel, so that the atexit handlers in user code would run.
 func (k *Kernel) Shutdown(ctx context.Context) error {
+	if k.GracefulShutdown && k.connected() {
+		m, err := k.message("control", "shutdown_request", map[string]any{
+			"restart": false,
+		})
+		if err != nil {
+			return err
+		}
+		// the gateway will clean up regardless, so a wedged kernel is only
+		// given so long to reply
+		rctx, cancel := context.WithTimeout(ctx, controlTimeout)
+		k.request(rctx, m)
+		cancel()
+	}
 	resp, err := k.Client.DeleteApiKernelsKernelId(ctx, k.ID)
 	if err != nil {
 		return fmt.Errorf("failed to shutdown: %w", err)
@@ -144,208 +699,679 @@ func (k *Kernel) Shutdown(ctx context.Context) error {
 	return k.Close()
 }
 
-// Execute
+// Execute submits the code, and returns the channel of its outputs.
+//
+// The channel is closed after the execute_reply, which is always the last
+// content delivered for the execution; it must be drained until then, or the
+// read loop blocks, once the buffer fills up. Should the kernel be busy, it's
+// interrupted first; see ExecuteWith for the other options.
 func (k *Kernel) Execute(ctx context.Context, code string) (chan *Content, error) {
-	ch := make(chan *Content, 1)
+	return k.ExecuteWith(ctx, code, nil)
+}
 
-	id, err := k.submit(ctx, code)
+// ExecuteWith is Execute with the options, if not nil.
+func (k *Kernel) ExecuteWith(ctx context.Context, code string, opts *ExecuteOptions) (chan *Content, error) {
+	h, err := k.submit(ctx, code, opts)
 	if err != nil {
 		return nil, err
 	}
-	go func() {
-		for c := range k.out {
-			if c.Message == id {
-				ch <- c
-				if c.Error != nil || c.Status != "" {
-					close(ch)
-					return
+	return h.sub.ch, nil
+}
+
+// ExecuteAll runs the cells in order, and returns the execute_reply of each
+// one; if stopOnError is set, it halts on the first failing cell.
+func (k *Kernel) ExecuteAll(ctx context.Context, cells []string, stopOnError bool) ([]*Content, error) {
+	replies := make([]*Content, 0, len(cells))
+	for i, code := range cells {
+		if err := ctx.Err(); err != nil {
+			return replies, err
+		}
+		h, err := k.submit(ctx, code, nil)
+		if err != nil {
+			return replies, fmt.Errorf("cell %d: %w", i, err)
+		}
+		var reply *Content
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				k.abandon(h.sub)
+				return replies, ctx.Err()
+			case c, ok := <-h.sub.ch:
+				if !ok {
+					break wait
 				}
+				reply = c
 			}
 		}
-	}()
-	return ch, nil
+		if reply == nil || reply.Type != "execute_reply" {
+			return replies, fmt.Errorf("cell %d: connection closed", i)
+		}
+		replies = append(replies, reply)
+		if stopOnError && reply.Error != nil {
+			return replies, fmt.Errorf("cell %d: %w", i, reply.Error)
+		}
+	}
+	return replies, nil
 }
 
+// Close disconnects from the kernel, leaving it running on the gateway.
+//
+// All of the content channels are closed as soon as the read loop stops;
+// see DrainOnClose to let the executions in flight finish first.
 func (k *Kernel) Close() (err error) {
+	if k.DrainOnClose > 0 && k.connected() {
+		ctx, cancel := context.WithTimeout(context.Background(), k.DrainOnClose)
+		k.Drain(ctx)
+		cancel()
+	}
+	k.wmu.Lock()
+	defer k.wmu.Unlock()
 	if k.conn == nil {
 		return
 	}
+	k.cancel()
 	err = k.conn.Close()
 	k.conn = nil
 	close(k.in)
-	close(k.out)
-	k.cancel()
 	return
 }
 
-func (k *Kernel) read(ctx context.Context) error {
+// Reconnect closes the connection, if any, and dials the kernel again, until
+// it succeeds, or the context is done, waiting between the attempts as per
+// Backoff; should the gateway reject the kernel, e.g. as it's gone, it gives
+// up with ErrHandshakeRejected. The subscriptions to the previous connection
+// are closed.
+func (k *Kernel) Reconnect(ctx context.Context) error {
+	if k.connected() {
+		k.Close()
+		// the read loop must be done with the old subscriptions
+		k.mu.Lock()
+		for !k.closed {
+			changed := k.changed
+			k.mu.Unlock()
+			<-changed
+			k.mu.Lock()
+		}
+		k.mu.Unlock()
+	}
+	k.in, k.out = nil, nil
+
+	b := k.Backoff
+	if b == nil {
+		b = backoff.Default
+	}
+	for attempt := 0; ; attempt++ {
+		err := NewKernel(ctx, k)
+		if err == nil {
+			k.stats.reconnects.Add(1)
+			return nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrHandshakeRejected) {
+			return err
+		}
+		if err := backoff.Sleep(ctx, b, attempt); err != nil {
+			return fmt.Errorf("failed to reconnect: %w", err)
+		}
+	}
+}
+
+func (k *Kernel) connected() bool {
+	k.wmu.Lock()
+	defer k.wmu.Unlock()
+	return k.conn != nil
+}
+
+// read is the only goroutine delivering the contents; when it returns, all
+// of the subscriptions are closed.
+func (k *Kernel) read(ctx context.Context, conn *websocket.Conn) {
+	defer k.teardown()
 	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			var m Message
-			if err := k.conn.ReadJSON(&m); err != nil {
-				return fmt.Errorf("failed to read message: %w", err)
+		m, err := k.recv(conn)
+		if err != nil {
+			if ctx.Err() == nil {
+				k.deliver(&Content{
+					Error: &Error{err: fmt.Errorf("failed to read message: %w", err)},
+				})
 			}
-			switch m.Type {
-			case "status":
-				var status jupyter.StatusMessage
-				if err := m.Unmarshal(&status); err != nil {
-					return fmt.Errorf("failed to unmarshal status: %w", err)
-				}
-				k.Status = string(status.ExecutionState)
-			case "stream", "display_data", "execute_reply":
-				var c Content
-				if err := m.Unmarshal(&c); err != nil {
-					return fmt.Errorf("failed to unmarshal stream: %w", err)
-				}
-				if h := m.ParentHeader; h != nil {
-					c.Message = uuid.MustParse(h.ID)
-				}
-				k.out <- &c
+			return
+		}
+		k.stats.received(m.Type)
+		if err := k.handle(m); err != nil {
+			k.deliver(&Content{
+				Message: m.Parent(),
+				Type:    m.Type,
+				Error:   &Error{err: err},
+			})
+		}
+	}
+}
+
+func (k *Kernel) handle(m *Message) error {
+	if m.Channel == "" {
+		// some gateways leave it out
+		m.Channel = "iopub"
+		if strings.HasSuffix(m.Type, "_reply") {
+			m.Channel = "shell"
+		}
+	}
+	switch m.Channel {
+	case "shell", "control":
+		if h := m.ParentHeader; h != nil {
+			k.mu.Lock()
+			ch := k.pending[h.ID]
+			k.mu.Unlock()
+			if ch != nil {
+				ch <- m
+				return nil
 			}
 		}
+		if m.Type == "execute_reply" {
+			return k.output(m)
+		}
+		k.custom(m)
+		return nil
+	case "stdin":
+		if m.Type == "input_request" {
+			return k.prompt(m)
+		}
+		k.custom(m)
+		return nil
+	}
+
+	switch m.Type {
+	case "status":
+		var status jupyter.StatusMessage
+		if err := m.Unmarshal(&status); err != nil {
+			return fmt.Errorf("failed to unmarshal status: %w", err)
+		}
+		// the kernel is busy with the control requests as well, but only
+		// for a moment, and regardless of the execution it may be running
+		if !k.controlled(m, string(status.ExecutionState)) {
+			k.setStatus(string(status.ExecutionState))
+			if status.ExecutionState == "busy" {
+				k.started(m.Parent())
+			}
+		}
+		if state := string(status.ExecutionState); died(state) {
+			k.died(state)
+		}
+		if k.StatusUpdates {
+			k.deliver(&Content{
+				Message: m.Parent(),
+				Type:    m.Type,
+				Channel: m.Channel,
+				State:   string(status.ExecutionState),
+			})
+		}
+	case "stream", "display_data", "execute_result", "error":
+		return k.output(m)
+	default:
+		k.custom(m)
+	}
+	return nil
+}
+
+// controlled tells whether the status message is on behalf of the request
+// sent over control; its idle is the last of them.
+func (k *Kernel) controlled(m *Message, state string) bool {
+	if m.ParentHeader == nil {
+		return false
+	}
+	id := m.ParentHeader.ID
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.control[id] {
+		return false
+	}
+	if state == "idle" {
+		delete(k.control, id)
+	}
+	return true
+}
+
+// Handle registers the handler of the messages of the type that's not
+// handled by the package, such as comm_msg, replacing the previous one;
+// the nil handler unregisters it.
+//
+// The replies awaited by the package, and the types it delivers as content,
+// never reach the handlers. The handler is invoked from the read loop, so
+// it must not block.
+func (k *Kernel) Handle(msgType string, fn func(*Message)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if fn == nil {
+		delete(k.handlers, msgType)
+		return
+	}
+	if k.handlers == nil {
+		k.handlers = make(map[string]func(*Message))
+	}
+	k.handlers[msgType] = fn
+}
+
+// custom dispatches the message to the handler of its type, if any.
+func (k *Kernel) custom(m *Message) {
+	k.mu.Lock()
+	fn := k.handlers[m.Type]
+	k.mu.Unlock()
+	if fn != nil {
+		fn(m)
+	}
+}
+
+// output delivers the message as content.
+func (k *Kernel) output(m *Message) error {
+	var c Content
+	if err := m.Unmarshal(&c); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", m.Type, err)
+	}
+	c.Type = m.Type
+	c.Channel = m.Channel
+	c.Message = m.Parent()
+	switch {
+	case m.Type == "error" || c.Status == "error":
+		c.Error = &Error{}
+		if err := m.Unmarshal(c.Error); err != nil {
+			return fmt.Errorf("failed to unmarshal error: %w", err)
+		}
+	case c.Status == "aborted":
+		c.Error = &Error{err: ErrAborted}
+	}
+	if c.Data != nil && c.Data.Markdown != "" && k.MarkdownRenderer != nil {
+		c.Data.Markdown = k.MarkdownRenderer(c.Data.Markdown)
+	}
+	if m.Type == "stream" {
+		k.complete(m, &c)
+		if c.Text == "" {
+			return nil // held back
+		}
+		k.metrics().Streamed(k.Name, len(c.Text))
+		k.stats.streamed.Add(int64(len(c.Text)))
+	}
+	if m.Type == "execute_reply" {
+		for _, tail := range k.leftovers(c.Message) {
+			k.deliver(tail)
+		}
+		k.elapsed(m, &c)
+		k.counted(&c)
+	}
+	k.deliver(&c)
+	return nil
+}
+
+// ExecutionReset is the type of the synthetic content, delivered once the
+// execution count goes backwards, i.e. the kernel was restarted behind our
+// back; the ExecutionCount is the new one.
+const ExecutionReset = "execution_reset"
+
+// counted tracks the execution count of the reply, and detects the resets.
+func (k *Kernel) counted(c *Content) {
+	if c.ExecutionCount == 0 {
+		return
+	}
+	k.mu.Lock()
+	reset := c.ExecutionCount < k.count
+	k.count = c.ExecutionCount
+	k.mu.Unlock()
+	if reset {
+		k.deliver(&Content{
+			Type:           ExecutionReset,
+			Channel:        c.Channel,
+			ExecutionCount: c.ExecutionCount,
+			Timestamp:      c.Timestamp,
+		})
+	}
+}
+
+// elapsed measures the duration of the execution from its reply: either
+// according to the kernel clock, if it reports the start time, as ipykernel
+// does, or otherwise, according to the local clock since the submission.
+func (k *Kernel) elapsed(m *Message, c *Content) {
+	k.mu.Lock()
+	x, ok := k.executions[c.Message]
+	if ok {
+		x.state = c.Status
+		delete(k.executions, c.Message)
+		k.broadcast()
+	}
+	k.mu.Unlock()
+
+	if h := m.Header; h != nil {
+		c.Timestamp = h.Date
+	}
+	if started, _ := m.Metadata["started"].(string); started != "" && !c.Timestamp.IsZero() {
+		if t, err := time.Parse(time.RFC3339Nano, started); err == nil {
+			c.Duration = c.Timestamp.Sub(t)
+			return
+		}
+	}
+	if ok {
+		c.Duration = time.Since(x.submitted)
+	}
+}
+
+// send writes the message, framed according to the negotiated protocol.
+func (k *Kernel) send(m *Message) error {
+	k.wmu.Lock()
+	defer k.wmu.Unlock()
+	if k.conn == nil {
+		return errClosed
+	}
+	if !k.v1 {
+		b, err := codec.Get().Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to encode message: %w", err)
+		}
+		return k.conn.WriteMessage(websocket.TextMessage, b)
+	}
+	b, err := encodeV1(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return k.conn.WriteMessage(websocket.BinaryMessage, b)
+}
+
+func (k *Kernel) recv(conn *websocket.Conn) (*Message, error) {
+	typ, b, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if typ == websocket.BinaryMessage {
+		return decodeV1(b)
+	}
+	var m Message
+	if err := codec.Get().Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (k *Kernel) setStatus(state string) {
+	k.mu.Lock()
+	k.Status = state
+	k.broadcast()
+	callbacks := slices.Clone(k.onStatus)
+	k.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(state)
+	}
+}
+
+// OnStatus registers the callback, invoked on every status message of the
+// kernel, i.e. "busy", or "idle", as it arrives.
+//
+// The callback is invoked from the read loop, so it must not block.
+func (k *Kernel) OnStatus(fn func(state string)) {
+	k.mu.Lock()
+	k.onStatus = append(k.onStatus, fn)
+	k.mu.Unlock()
+}
+
+// ErrKernelDied is the error of the content delivered to every subscriber,
+// and the executions in flight, once the kernel dies, or is restarted, and
+// so they will never complete.
+var ErrKernelDied = errors.New("kernel died")
+
+func died(state string) bool {
+	switch state {
+	case "dead", "restarting", "autorestarting":
+		return true
+	}
+	return false
+}
+
+// died reports the death of the kernel to everyone concerned.
+func (k *Kernel) died(state string) {
+	k.mu.Lock()
+	callbacks := slices.Clone(k.onDied)
+	k.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(state)
+	}
+	k.deliver(&Content{
+		Type:  "status",
+		State: state,
+		Error: &Error{err: fmt.Errorf("%w: %s", ErrKernelDied, state)},
+	})
+
+	// the executions in flight will never be replied to
+	k.mu.Lock()
+	var orphans []*subscription
+	k.subs = slices.DeleteFunc(k.subs, func(sub *subscription) bool {
+		if sub.id == uuid.Nil {
+			return false
+		}
+		orphans = append(orphans, sub)
+		return true
+	})
+	for _, x := range k.executions {
+		x.state = "error"
 	}
+	clear(k.executions)
+	k.broadcast()
+	k.mu.Unlock()
+	for _, sub := range orphans {
+		close(sub.ch)
+	}
+}
+
+// OnKernelDied registers the callback, invoked once the kernel reports it's
+// "dead", or "restarting", so that the supervisor could recreate it; the
+// state of the kernel, i.e. its variables, is lost either way.
+//
+// The callback is invoked from the read loop, so it must not block.
+func (k *Kernel) OnKernelDied(fn func(state string)) {
+	k.mu.Lock()
+	k.onDied = append(k.onDied, fn)
+	k.mu.Unlock()
 }
 
-func (k *Kernel) submit(ctx context.Context, code string) (uuid.UUID, error) {
-	if k.Status == "busy" {
-		if err := k.Interrupt(ctx); err != nil {
-			return uuid.Nil, fmt.Errorf("busy kernel: %w", err)
+// broadcast wakes up those waiting for the status to change, executions to
+// finish, or the connection to close; k.mu must be held.
+func (k *Kernel) broadcast() {
+	close(k.changed)
+	k.changed = make(chan struct{})
+}
+
+func (k *Kernel) status() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.Status
+}
+
+// submit sends the execute request, and subscribes to its contents.
+func (k *Kernel) submit(ctx context.Context, code string, opts *ExecuteOptions) (*ExecuteHandle, error) {
+	if opts == nil {
+		opts = &ExecuteOptions{}
+	}
+	switch opts.OnBusy {
+	case OnBusyInterrupt:
+		if k.status() == "busy" {
+			if err := k.InterruptWait(ctx); err != nil {
+				return nil, fmt.Errorf("busy kernel: %w", err)
+			}
+		}
+	case OnBusyReject:
+		k.mu.Lock()
+		busy := k.Status == "busy" || len(k.executions) > 0
+		k.mu.Unlock()
+		if busy {
+			return nil, ErrKernelBusy
 		}
 	}
 
-	c := map[string]any{
+	m, err := k.message("shell", "execute_request", map[string]any{
 		"code":             code,
 		"silent":           false,
 		"store_history":    true,
 		"user_expressions": map[string]any{},
-		"allow_stdin":      false,
+		"allow_stdin":      k.AllowStdin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.MustParse(m.Header.ID)
+	x := &execution{submitted: time.Now(), state: "queued"}
+	if err := k.admit(ctx, id, x); err != nil {
+		return nil, err
+	}
+	sub := k.subscribe(&subscription{id: id})
+	if err := k.send(m); err != nil {
+		k.unsubscribe(sub)
+		k.mu.Lock()
+		delete(k.executions, id)
+		k.mu.Unlock()
+		return nil, err
 	}
-	b, err := json.Marshal(c)
+	k.metrics().Executed(k.Name)
+	k.stats.executions.Add(1)
+	return &ExecuteHandle{ID: id, Outputs: sub.ch, k: k, x: x, sub: sub}, nil
+}
+
+// message builds a new request message.
+func (k *Kernel) message(channel, msgType string, content any) (*Message, error) {
+	b, err := codec.Get().Marshal(content)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to marshal execute request: %w", err)
+		return nil, fmt.Errorf("failed to marshal %s: %w", msgType, err)
 	}
-	id := uuid.New()
-	return id, k.conn.WriteJSON(&Message{
+	return &Message{
 		Header: &Header{
-			Type:     "execute_request",
-			ID:       id.String(),
+			Type:     msgType,
+			ID:       uuid.NewString(),
 			Username: k.User,
 			Session:  k.Session,
-			Version:  "5.0",
+			Version:  k.Protocol(),
 		},
 		ParentHeader: &Header{},
-		Channel:      "shell",
+		Channel:      channel,
 		Content:      b,
 		Metadata:     map[string]any{},
 		Buffers:      []any{},
-	})
+	}, nil
+}
+
+// request sends the message, and waits for the reply.
+func (k *Kernel) request(ctx context.Context, m *Message) (*Message, error) {
+	id := m.Header.ID
+	ch := make(chan *Message, 1)
+	k.mu.Lock()
+	k.pending[id] = ch
+	if m.Channel == "control" {
+		k.control[id] = true
+	}
+	k.mu.Unlock()
+	defer func() {
+		k.mu.Lock()
+		delete(k.pending, id)
+		k.mu.Unlock()
+	}()
+
+	if err := k.send(m); err != nil {
+		k.mu.Lock()
+		delete(k.control, id)
+		k.mu.Unlock()
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case reply := <-ch:
+		return reply, nil
+	}
+}
+
+// KernelInfo describes the kernel implementation, and its language.
+type KernelInfo struct {
+	Status                string `json:"status"`
+	ProtocolVersion       string `json:"protocol_version"`
+	Implementation        string `json:"implementation"`
+	ImplementationVersion string `json:"implementation_version"`
+	Banner                string `json:"banner"`
+	LanguageInfo          struct {
+		Name          string `json:"name"`
+		Version       string `json:"version"`
+		MimeType      string `json:"mimetype"`
+		FileExtension string `json:"file_extension"`
+	} `json:"language_info"`
 }
 
 type Content struct {
 	Message uuid.UUID `json:"-"`
+	Type    string    `json:"-"`
 
 	// Actual content
 	Channel string `json:"channel,omitempty"`
+	Name    string `json:"name,omitempty"` // stream name: stdout, stderr
 	Code    string `json:"code,omitempty"` // stream data
 	Text    string `json:"text,omitempty"` // stream data
 	Data    *Data  `json:"data,omitempty"`
 
+	// Input request
+	Prompt   string `json:"prompt,omitempty"`
+	Password bool   `json:"password,omitempty"`
+
 	// Result
-	Status         string    `json:"status"`
-	ExecutionCount int       `json:"execution_count"`
-	Timestamp      time.Time `json:"date"`
+	State          string        `json:"execution_state,omitempty"` // status
+	Status         string        `json:"status,omitempty"`
+	ExecutionCount int           `json:"execution_count,omitempty"`
+	Timestamp      time.Time     `json:"date,omitzero"`
+	Duration       time.Duration `json:"-"` // execute_reply
+	Payload        []Payload     `json:"payload,omitempty"`
 
 	// Metadata
-	Metadata  map[string]any `json:"metadata"`
-	Transient map[string]any `json:"transient"`
-	Error     *Error         `json:"-"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Transient map[string]any `json:"transient,omitempty"`
+	Error     *Error         `json:"error,omitempty"`
 }
 
-// String64 is a base64 encoded string.
-type String64 string
-
-func (s String64) Bytes() ([]byte, error) {
-	return base64.StdEncoding.DecodeString(string(s))
+// storedContent are the fields of the content that come from the message,
+// rather than its content, which are only present once it's stored.
+type storedContent struct {
+	Message  uuid.UUID     `json:"parent_msg_id,omitzero"`
+	Type     string        `json:"msg_type,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
 }
 
-type Data struct {
-	Plaintext string `json:"text/plain"`
-	Markdown  string `json:"text/markdown"`
-	Latex     string `json:"text/latex"`
-	JS        string `json:"application/javascript"`
-	JSON      string `json:"application/json"`
-	HTML      string `json:"text/html"`
-
-	PNG String64 `json:"image/png"`
-	JPG String64 `json:"image/jpeg"`
-	SVG String64 `json:"image/svg+xml"`
+// MarshalJSON includes the parent message id, type, and duration, so that
+// the content could be stored, and restored as it was delivered.
+func (c Content) MarshalJSON() ([]byte, error) {
+	type content Content
+	return codec.Get().Marshal(struct {
+		content
+		storedContent
+	}{content(c), storedContent{c.Message, c.Type, c.Duration}})
 }
 
-func (m *Data) Text() (string, bool) {
-	switch {
-	case m.Plaintext != "":
-		return m.Plaintext, true
-	case m.Markdown != "":
-		return m.Markdown, true
-	case m.Latex != "":
-		return m.Latex, true
-	case m.JS != "":
-		return m.JS, true
-	case m.JSON != "":
-		return m.JSON, true
-	case m.HTML != "":
-		return m.HTML, true
-	}
-	return "", false
-}
-
-func (m *Data) Multipart() (b []byte, mimeType string, err error) {
-	switch {
-	case m.PNG != "":
-		mimeType = "image/png"
-		b, err = m.PNG.Bytes()
-	case m.JPG != "":
-		mimeType = "image/jpeg"
-		b, err = m.JPG.Bytes()
-	case m.SVG != "":
-		mimeType = "image/svg+xml"
-		b, err = m.SVG.Bytes()
-	}
-	if err != nil || b != nil {
-		return
+func (c *Content) UnmarshalJSON(b []byte) error {
+	type content Content
+	var v struct {
+		*content
+		storedContent
 	}
-	return nil, "", io.EOF
+	v.content = (*content)(c)
+	if err := codec.Get().Unmarshal(b, &v); err != nil {
+		return err
+	}
+	s := v.storedContent
+	c.Message, c.Type, c.Duration = s.Message, s.Type, s.Duration
+	return nil
 }
 
-type Error struct {
-	Ename     string   `json:"ename"`
-	Evalue    string   `json:"evalue"`
-	Traceback []string `json:"traceback"`
+// Payload is a side-effect of execute_reply, i.e. pager output of `?obj`.
+//
+// https://jupyter-client.readthedocs.io/en/latest/messaging.html#payloads-deprecated
+type Payload struct {
+	Source string `json:"source"`
 
-	err error `json:"-"`
-}
+	// page
+	Data  *Data `json:"data,omitempty"`
+	Start int   `json:"start,omitempty"`
 
-func (e Error) Error() string {
-	if e.err != nil {
-		return e.err.Error()
-	}
-	return fmt.Sprintf("%s: %s", e.Ename, e.Evalue)
-}
+	// set_next_input
+	Text    string `json:"text,omitempty"`
+	Replace bool   `json:"replace,omitempty"`
 
-func (e Error) String() string {
-	if e.err != nil {
-		return fmt.Sprintf("%+v", e.err)
-	}
-	var s strings.Builder
-	s.WriteString(e.Ename)
-	s.WriteString(": ")
-	s.WriteString(e.Evalue)
-	for _, tb := range e.Traceback {
-		s.WriteString("\n")
-		s.WriteString(stripansi.Strip(tb))
-	}
-	return s.String()
+	// ask_exit
+	KeepKernel bool `json:"keepkernel,omitempty"`
 }
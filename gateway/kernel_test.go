@@ -2,16 +2,38 @@ package gateway
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/busthorne/cablectl/backoff"
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+	"github.com/google/uuid"
 )
 
 func TestHelloWorld(t *testing.T) {
 	ctx := context.Background()
 
-	gatewayURL, err := url.Parse(os.Getenv("GATEWAY_URL"))
+	gw := os.Getenv("GATEWAY_URL")
+	if gw == "" {
+		srv := gatewaytest.NewServer()
+		defer srv.Close()
+		gw = srv.URL
+	}
+	gatewayURL, err := url.Parse(gw)
 	if err != nil {
 		t.Fatalf("Failed to parse gateway URL: %v", err)
 	}
@@ -54,3 +76,880 @@ func TestHelloWorld(t *testing.T) {
 	}
 	t.Log("Kernel shutdown.")
 }
+
+// unresponsive accepts the connections, but never responds.
+func unresponsive(t *testing.T) *url.URL {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	k := &Kernel{
+		ID:               uuid.New(),
+		Name:             "python3",
+		URL:              unresponsive(t),
+		HandshakeTimeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	err := NewKernel(context.Background(), k)
+	if !errors.Is(err, ErrHandshakeTimeout) {
+		t.Fatalf("Expected handshake timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected to give up after 100ms, took %s", elapsed)
+	}
+}
+
+func TestDialCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	k := &Kernel{ID: uuid.New(), Name: "python3", URL: unresponsive(t)}
+	start := time.Now()
+	err := NewKernel(ctx, k)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the dial cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected to give up once cancelled, took %s", elapsed)
+	}
+}
+
+func TestNewKernelTimeout(t *testing.T) {
+	k := &Kernel{ID: uuid.New(), Name: "python3", URL: unresponsive(t)}
+	start := time.Now()
+	err := NewKernelTimeout(context.Background(), k, 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected to give up after 100ms, took %s", elapsed)
+	}
+}
+
+func TestDialCleanup(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Unavailable = true
+	u, _ := url.Parse(srv.URL)
+
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(context.Background(), k); err == nil {
+		t.Fatal("Expected the dial to fail")
+	}
+	if kernels := srv.Kernels(); len(kernels) != 0 {
+		t.Fatalf("Expected the kernel shut down, got %v", kernels)
+	}
+	if k.ID != uuid.Nil {
+		t.Fatalf("Expected the kernel id reset, got %s", k.ID)
+	}
+}
+
+func TestBaseContext(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	// the request that created the kernel is over
+	cancel()
+
+	r, err := k.Run(context.Background(), `hello`, nil)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Status != "ok" {
+		t.Fatalf("Expected to run after the setup context is done, got %q", r.Status)
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	mounted := httptest.NewServer(http.StripPrefix("/gateway", srv.Config.Handler))
+	defer mounted.Close()
+	u, _ := url.Parse(mounted.URL + "/gateway/")
+
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(context.Background(), k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Shutdown(context.Background())
+	r, err := k.Run(context.Background(), `hello`, nil)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Status != "ok" {
+		t.Fatalf("Expected to run under the path prefix, got %q", r.Status)
+	}
+
+	secure := &Kernel{ID: k.ID}
+	secure.URL, _ = url.Parse("https://example.com/gateway")
+	if want := "wss://example.com/gateway/api/kernels/" + k.ID.String() + "/channels"; secure.channels() != want {
+		t.Fatalf("Expected %s, got %s", want, secure.channels())
+	}
+}
+
+func TestGatewayURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://localhost:8888/":        "http://localhost:8888",
+		"https://example.com/gateway//": "https://example.com/gateway",
+		"localhost:8888":                "http://localhost:8888",
+		"example.com/gateway/":          "http://example.com/gateway",
+		"ftp://example.com":             "",
+		"http:///gateway":               "",
+		"":                              "",
+	} {
+		u, _ := url.Parse(raw)
+		got, err := gatewayURL(u)
+		switch {
+		case want == "" && err == nil:
+			t.Errorf("Expected %q to be rejected, got %s", raw, got)
+		case want != "" && err != nil:
+			t.Errorf("Failed to normalize %q: %v", raw, err)
+		case want != "" && got.String() != want:
+			t.Errorf("Expected %q normalized to %s, got %s", raw, want, got)
+		}
+	}
+	if _, err := gatewayURL(nil); err == nil {
+		t.Errorf("Expected the nil url to be rejected")
+	}
+}
+
+func TestContentJSON(t *testing.T) {
+	c := Content{
+		Message:        uuid.New(),
+		Type:           "execute_reply",
+		Channel:        "shell",
+		Status:         "error",
+		ExecutionCount: 3,
+		Timestamp:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:       1500 * time.Millisecond,
+		Error:          &Error{Ename: "KeyError", Evalue: "'x'", Traceback: []string{}},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var got Content
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Fatalf("Round-trip mismatch:\nwant %+v\n got %+v", c, got)
+	}
+
+	b, _ = json.Marshal(Content{Type: "stream", Name: "stdout", Text: "hi"})
+	if want := `{"name":"stdout","text":"hi","msg_type":"stream"}`; string(b) != want {
+		t.Fatalf("Expected %s, got %s", want, b)
+	}
+}
+
+func TestExecutionReset(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	for _, reconnect := range []bool{false, true} {
+		resets := k.Subscribe(ExecutionReset)
+		for range 2 {
+			if _, err := k.Run(ctx, "x", nil); err != nil {
+				t.Fatalf("Failed to run: %v", err)
+			}
+		}
+		// restarted out-of-band, possibly while disconnected
+		resp, err := k.Client.PostApiKernelsKernelIdRestart(ctx, k.ID)
+		if err != nil {
+			t.Fatalf("Failed to restart: %v", err)
+		}
+		resp.Body.Close()
+		if reconnect {
+			if err := k.Reconnect(ctx); err != nil {
+				t.Fatalf("Failed to reconnect: %v", err)
+			}
+			resets = k.Subscribe(ExecutionReset)
+		}
+		if _, err := k.Run(ctx, "x", nil); err != nil {
+			t.Fatalf("Failed to run: %v", err)
+		}
+		select {
+		case c := <-resets:
+			if c.ExecutionCount != 1 {
+				t.Fatalf("Expected the count reset to 1, got %d", c.ExecutionCount)
+			}
+		default:
+			t.Fatalf("Expected the reset detected, reconnecting: %v", reconnect)
+		}
+	}
+}
+
+func TestOnStatus(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	var (
+		mu     sync.Mutex
+		states []string
+	)
+	k.OnStatus(func(state string) {
+		mu.Lock()
+		states = append(states, state)
+		mu.Unlock()
+	})
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	if _, err := k.Run(ctx, "x", nil); err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if err := k.Drain(ctx); err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	i := slices.Index(states, "busy")
+	if i < 0 || !slices.Contains(states[i:], "idle") {
+		t.Fatalf("Expected busy, then idle, got %v", states)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{
+		Name:    "python3",
+		URL:     u,
+		Backoff: backoff.Exponential{Base: 10 * time.Millisecond},
+	}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	id, session := k.ID, k.Session
+	if session == "" {
+		t.Fatalf("Expected the session generated")
+	}
+
+	outputs := k.Listen()
+	if err := k.Reconnect(ctx); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	for range outputs {
+	}
+	if k.ID != id || k.Session != session {
+		t.Fatalf("Expected the same kernel, and session, got %s, %s", k.ID, k.Session)
+	}
+	if r, err := k.Run(ctx, "x", nil); err != nil || r.Status != "ok" {
+		t.Fatalf("Failed to run after reconnecting: %v", err)
+	}
+
+	srv.Unavailable = true
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := k.Reconnect(tctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected to give up on the deadline, got %v", err)
+	}
+
+	// the kernel culled by the gateway is never coming back
+	srv.Unavailable = false
+	resp, err := k.Client.DeleteApiKernelsKernelId(ctx, k.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete kernel: %v", err)
+	}
+	resp.Body.Close()
+	if err := k.Reconnect(ctx); !errors.Is(err, ErrHandshakeRejected) {
+		t.Fatalf("Expected to give up on the kernel gone, got %v", err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	k := &Kernel{}
+	var got []string
+	k.Handle("comm_msg", func(m *Message) {
+		got = append(got, m.Type+":"+string(m.Content))
+	})
+	k.Handle("comm_close", func(m *Message) {
+		got = append(got, m.Type)
+	})
+	k.Handle("comm_close", nil)
+
+	for _, m := range []*Message{
+		{Channel: "iopub", Type: "comm_msg", Content: json.RawMessage(`{}`)},
+		{Channel: "iopub", Type: "comm_close"},
+		{Channel: "shell", Type: "comm_info_reply"},
+	} {
+		if err := k.handle(m); err != nil {
+			t.Fatalf("Failed to handle %s: %v", m.Type, err)
+		}
+	}
+	if !slices.Equal(got, []string{"comm_msg:{}"}) {
+		t.Fatalf("Expected only the registered handler invoked, got %v", got)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	var (
+		mu     sync.Mutex
+		agents = map[string]bool{}
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.UserAgent()] = true
+		mu.Unlock()
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+
+	k := &Kernel{Name: "python3", URL: u, UserAgent: "agent/1.0"}
+	if err := NewKernel(context.Background(), k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(agents) != 1 || !agents["agent/1.0"] {
+		t.Fatalf("Expected the user agent on every request, got %v", agents)
+	}
+}
+
+func TestReuseExisting(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	first := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, first); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer first.Close()
+
+	k := &Kernel{Name: "python3", URL: u, ReuseExisting: true}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to attach to kernel: %v", err)
+	}
+	defer k.Close()
+	if k.ID != first.ID || len(srv.Kernels()) != 1 {
+		t.Fatalf("Expected the running kernel reused, got %s of %v", k.ID, srv.Kernels())
+	}
+	if r, err := k.Run(ctx, "x", nil); err != nil || r.Status != "ok" {
+		t.Fatalf("Failed to run on the reused kernel: %v", err)
+	}
+
+	other := &Kernel{Name: "julia", URL: u, ReuseExisting: true}
+	if err := NewKernel(ctx, other); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer other.Close()
+	if other.ID == first.ID || len(srv.Kernels()) != 2 {
+		t.Fatalf("Expected a new kernel of the other name, got %s of %v", other.ID, srv.Kernels())
+	}
+}
+
+func TestWSHeaders(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	headers := make(chan http.Header, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/channels") {
+			headers <- r.Header.Clone()
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+
+	k := &Kernel{
+		Name:      "python3",
+		URL:       u,
+		Origin:    "https://notebooks.example.com",
+		WSHeaders: http.Header{"Authorization": {"Bearer token"}},
+	}
+	if err := NewKernel(context.Background(), k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	h := <-headers
+	if h.Get("Origin") != k.Origin || h.Get("Authorization") != "Bearer token" {
+		t.Fatalf("Expected the origin, and the headers on the upgrade, got %v", h)
+	}
+	if len(k.WSHeaders) != 1 {
+		t.Fatalf("Expected the headers left alone, got %v", k.WSHeaders)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	cookies := make(chan *http.Cookie, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/channels") {
+			c, _ := r.Cookie("gateway_session")
+			cookies <- c
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(context.Background(), k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	if c := <-cookies; c == nil || c.Value != k.ID.String() {
+		t.Fatalf("Expected the cookie set on creation replayed on the upgrade, got %v", c)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	for _, graceful := range []bool{false, true} {
+		before := srv.Received("shutdown_request")
+		k := &Kernel{Name: "python3", URL: u, GracefulShutdown: graceful}
+		if err := NewKernel(ctx, k); err != nil {
+			t.Fatalf("Failed to create kernel: %v", err)
+		}
+		if err := k.Shutdown(ctx); err != nil {
+			t.Fatalf("Failed to shut down: %v", err)
+		}
+		if ids := srv.Kernels(); len(ids) != 0 {
+			t.Fatalf("Expected the kernel deleted, got %v", ids)
+		}
+		if n := srv.Received("shutdown_request") - before; graceful != (n == 1) {
+			t.Fatalf("Expected the shutdown_request only when graceful, got %d with %v", n, graceful)
+		}
+		if k.ID != uuid.Nil || k.connected() {
+			t.Fatalf("Expected the kernel forgotten, and closed")
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	var ran []string
+	srv.Exec = func(code string) gatewaytest.Reply {
+		ran = append(ran, code)
+		if code == "1/0" {
+			return gatewaytest.Reply{Error: &gatewaytest.Error{Ename: "ZeroDivisionError"}}
+		}
+		return gatewaytest.Reply{}
+	}
+	u, _ := url.Parse(srv.URL)
+
+	k := &Kernel{Name: "python3", URL: u, Init: []string{"import os", "def f(): pass"}}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	k.Shutdown(ctx)
+	if !slices.Equal(ran, k.Init) {
+		t.Fatalf("Expected the preamble run, got %v", ran)
+	}
+
+	k = &Kernel{Name: "python3", URL: u, Init: []string{"1/0", "unreachable"}}
+	var e *Error
+	if err := NewKernel(ctx, k); !errors.As(err, &e) || e.Ename != "ZeroDivisionError" {
+		t.Fatalf("Expected the preamble to fail, got %v", err)
+	}
+	if ids := srv.Kernels(); len(ids) != 0 {
+		t.Fatalf("Expected the kernel shut down, got %v", ids)
+	}
+}
+
+func TestKernelDied(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Stdout: "allocating", Dies: true}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	died := make(chan string, 1)
+	k.OnKernelDied(func(state string) { died <- state })
+
+	if _, err := k.Run(ctx, "x = [0] * 10**12", nil); !errors.Is(err, ErrKernelDied) {
+		t.Fatalf("Expected the kernel died, got %v", err)
+	}
+	if state := <-died; state != "dead" {
+		t.Fatalf("Expected dead, got %q", state)
+	}
+
+	h, err := k.Start(ctx, "again")
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	var last *Content
+	for c := range h.Outputs {
+		last = c
+	}
+	if last == nil || !errors.Is(last.Error, ErrKernelDied) || last.Error.Kind() != DiedError {
+		t.Fatalf("Expected the execution closed with the error, got %v", last)
+	}
+	if status := h.Status(); status != "error" {
+		t.Fatalf("Expected the execution failed, got %q", status)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	b, err := k.Debug(ctx, map[string]any{
+		"command":   "setBreakpoints",
+		"arguments": map[string]any{"breakpoints": []map[string]int{{"line": 2}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to debug: %v", err)
+	}
+	var resp struct {
+		RequestSeq int    `json:"request_seq"`
+		Command    string `json:"command"`
+	}
+	json.Unmarshal(b, &resp)
+	if resp.RequestSeq != 1 || resp.Command != "setBreakpoints" {
+		t.Fatalf("Unexpected response: %s", b)
+	}
+	if _, err := k.Debug(ctx, map[string]any{"command": "unsupported"}); err == nil {
+		t.Fatalf("Expected the unsuccessful response to fail")
+	}
+}
+
+// counting is the codec that counts the messages decoded by encoding/json.
+type counting struct {
+	unmarshal atomic.Int32
+}
+
+func (c *counting) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (c *counting) Unmarshal(data []byte, v any) error {
+	c.unmarshal.Add(1)
+	return json.Unmarshal(data, v)
+}
+
+func TestSetCodec(t *testing.T) {
+	cc := &counting{}
+	SetCodec(cc)
+	t.Cleanup(func() { SetCodec(nil) })
+
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	n := cc.unmarshal.Load()
+	if _, err := k.Run(ctx, "x", nil); err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if cc.unmarshal.Load() == n {
+		t.Fatalf("Expected the messages decoded by the codec")
+	}
+}
+
+func TestAlive(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Delay: time.Minute}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	h, err := k.Start(ctx, "import time; time.sleep(60)")
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	for h.Status() != "running" {
+		time.Sleep(time.Millisecond)
+	}
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	// the second probe is only replied to after the idle of the first
+	for range 2 {
+		if !k.Alive(tctx) {
+			t.Fatal("Expected the kernel alive during the long execution")
+		}
+	}
+	if status := k.status(); status != "busy" {
+		t.Fatalf("Expected the kernel still busy with the execution, got %q", status)
+	}
+	wctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := k.WaitReady(wctx); err == nil {
+		t.Fatal("Expected the kernel not ready during the long execution")
+	}
+	k.Close()
+	if k.Alive(ctx) {
+		t.Fatal("Expected the closed kernel not alive")
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Startup = 200 * time.Millisecond
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	start := time.Now()
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	// control is answered as the kernel starts, yet it's not ready
+	if !k.Alive(ctx) {
+		t.Fatal("Expected the starting kernel alive")
+	}
+	if err := k.WaitReady(ctx); err != nil {
+		t.Fatalf("Failed to wait: %v", err)
+	}
+	if d := time.Since(start); d < srv.Startup {
+		t.Fatalf("Expected the kernel ready after it started, got %s", d)
+	}
+	if out, err := k.Eval(ctx, "ready"); err != nil || out != "ready" {
+		t.Fatalf("Expected the execution, got %q, %v", out, err)
+	}
+}
+
+func TestInterruptWait(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		if code == "slow" {
+			return gatewaytest.Reply{Delay: time.Minute}
+		}
+		return gatewaytest.Reply{Stdout: code}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	running := func() *ExecuteHandle {
+		h, err := k.Start(ctx, "slow")
+		if err != nil {
+			t.Fatalf("Failed to start: %v", err)
+		}
+		go func() {
+			for range h.Outputs {
+			}
+		}()
+		for h.Status() != "running" {
+			time.Sleep(time.Millisecond)
+		}
+		return h
+	}
+
+	h := running()
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := k.InterruptWait(tctx); err != nil {
+		t.Fatalf("Failed to interrupt: %v", err)
+	}
+	if status := h.Status(); status != "error" {
+		t.Fatalf("Expected the execution interrupted by the time, got %q", status)
+	}
+
+	// the busy kernel is interrupted before the next execution, by default
+	h = running()
+	if out, err := k.Eval(tctx, "next"); err != nil || out != "next" {
+		t.Fatalf("Expected the execution, got %q, %v", out, err)
+	}
+	if status := h.Status(); status != "error" {
+		t.Fatalf("Expected the running execution interrupted, got %q", status)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+	if p := k.Protocol(); p != "5.3" {
+		t.Fatalf("Expected the protocol reported by the kernel, got %s", p)
+	}
+}
+
+// proxy forwards the connections to the server, counting the bytes that
+// come back, i.e. the size of the outputs on the wire.
+func proxy(tb testing.TB, server string) (*url.URL, *atomic.Int64) {
+	u, _ := url.Parse(server)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("Failed to listen: %v", err)
+	}
+	tb.Cleanup(func() { ln.Close() })
+	var n atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				up, err := net.Dial("tcp", u.Host)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+				go io.Copy(up, conn)
+				io.Copy(&counted{conn, &n}, up)
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}, &n
+}
+
+type counted struct {
+	io.Writer
+	n *atomic.Int64
+}
+
+func (c *counted) Write(b []byte) (int, error) {
+	c.n.Add(int64(len(b)))
+	return c.Writer.Write(b)
+}
+
+// plot is the display_data of a figure, compressible as the plots are.
+func plot() map[string]any {
+	png := []byte(strings.Repeat("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", 64<<10))
+	return map[string]any{
+		"text/plain": "<Figure size 640x480 with 1 Axes>",
+		"image/png":  base64.StdEncoding.EncodeToString(png),
+	}
+}
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	display := plot()
+	size := int64(len(display["image/png"].(string)))
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Displays: []map[string]any{display}}
+	}
+
+	for _, compression := range []bool{false, true} {
+		u, wire := proxy(t, srv.URL)
+		k := &Kernel{Name: "python3", URL: u, Compression: compression}
+		if err := NewKernel(ctx, k); err != nil {
+			t.Fatalf("Failed to create kernel: %v", err)
+		}
+		before := wire.Load()
+		if _, err := k.Run(ctx, "plot()", nil); err != nil {
+			t.Fatalf("Failed to run: %v", err)
+		}
+		n := wire.Load() - before
+		k.Close()
+		switch {
+		case compression && n >= size/2:
+			t.Fatalf("Expected the deflated plot on the wire, got %d bytes of %d", n, size)
+		case !compression && n < size:
+			t.Fatalf("Expected the plot uncompressed, got %d bytes of %d", n, size)
+		}
+	}
+}
+
+// BenchmarkCompression runs the cell that displays a plot, with, and without
+// permessage-deflate; over the loopback, the time is mostly the cost of the
+// deflate, while the wire bytes tell the gain on a remote connection.
+func BenchmarkCompression(b *testing.B) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	display := plot()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Displays: []map[string]any{display}}
+	}
+
+	for _, bench := range []struct {
+		name        string
+		compression bool
+	}{{"plain", false}, {"deflate", true}} {
+		b.Run(bench.name, func(b *testing.B) {
+			u, wire := proxy(b, srv.URL)
+			k := &Kernel{Name: "python3", URL: u, Compression: bench.compression}
+			if err := NewKernel(ctx, k); err != nil {
+				b.Fatalf("Failed to create kernel: %v", err)
+			}
+			defer k.Close()
+			before := wire.Load()
+			b.SetBytes(int64(len(display["image/png"].(string))))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := k.Run(ctx, "plot()", nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(wire.Load()-before)/float64(b.N), "wire-bytes/op")
+		})
+	}
+}
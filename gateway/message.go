@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Message struct {
@@ -28,7 +30,16 @@ type Header struct {
 }
 
 func (m *Message) Unmarshal(v any) error {
-	return json.Unmarshal(m.Content, v)
+	return codec.Get().Unmarshal(m.Content, v)
+}
+
+// Parent returns the id of the request that caused the message, if any.
+func (m *Message) Parent() uuid.UUID {
+	if m.ParentHeader == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(m.ParentHeader.ID)
+	return id
 }
 
 func (m Message) String() string {
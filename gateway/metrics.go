@@ -0,0 +1,28 @@
+package gateway
+
+// Metrics receives instrumentation events from the kernel.
+//
+// The package doesn't depend on any metrics library; implement this
+// against your registry of choice, and set it on the kernel before
+// calling NewKernel.
+type Metrics interface {
+	// KernelCreated is called when a new kernel is started on the gateway.
+	KernelCreated(name string)
+	// Executed is called for every execute request submitted to the kernel.
+	Executed(name string)
+	// Streamed is called with the size of every stream chunk received.
+	Streamed(name string, n int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) KernelCreated(string) {}
+func (nopMetrics) Executed(string)      {}
+func (nopMetrics) Streamed(string, int) {}
+
+func (k *Kernel) metrics() Metrics {
+	if k.Metrics == nil {
+		return nopMetrics{}
+	}
+	return k.Metrics
+}
@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExportNotebook renders the executed cells, and their outputs, as nbformat
+// v4 notebook, which is to say, a valid .ipynb file.
+//
+// The outputs of each cell are the contents delivered by Execute, in order;
+// execute_reply determines the execution count of the cell.
+//
+// https://nbformat.readthedocs.io/en/latest/format_description.html
+func (k *Kernel) ExportNotebook(cells []string, outputs [][]*Content) ([]byte, error) {
+	if len(outputs) > len(cells) {
+		return nil, fmt.Errorf("%d outputs for %d cells", len(outputs), len(cells))
+	}
+
+	nb := map[string]any{
+		"nbformat":       4,
+		"nbformat_minor": 4,
+		"metadata": map[string]any{
+			"kernelspec": map[string]string{
+				"name":         k.Name,
+				"display_name": k.Name,
+			},
+		},
+	}
+	nbcells := make([]map[string]any, len(cells))
+	for i, code := range cells {
+		var (
+			count any // null, unless executed
+			outs  = []map[string]any{}
+		)
+		if i < len(outputs) {
+			for _, c := range outputs[i] {
+				if c.Type == "execute_reply" {
+					count = c.ExecutionCount
+					continue
+				}
+				if out := nbOutput(c); out != nil {
+					outs = append(outs, out)
+				}
+			}
+		}
+		nbcells[i] = map[string]any{
+			"cell_type":       "code",
+			"execution_count": count,
+			"metadata":        map[string]any{},
+			"source":          code,
+			"outputs":         outs,
+		}
+	}
+	nb["cells"] = nbcells
+	return json.MarshalIndent(nb, "", " ")
+}
+
+func nbOutput(c *Content) map[string]any {
+	data := c.Data
+	if data == nil {
+		data = &Data{}
+	}
+	metadata := c.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	switch c.Type {
+	case "stream":
+		return map[string]any{
+			"output_type": "stream",
+			"name":        c.Name,
+			"text":        c.Text,
+		}
+	case "display_data":
+		return map[string]any{
+			"output_type": "display_data",
+			"data":        data,
+			"metadata":    metadata,
+		}
+	case "execute_result":
+		return map[string]any{
+			"output_type":     "execute_result",
+			"execution_count": c.ExecutionCount,
+			"data":            data,
+			"metadata":        metadata,
+		}
+	case "error":
+		if c.Error == nil {
+			return nil
+		}
+		traceback := c.Error.Traceback
+		if traceback == nil {
+			traceback = []string{}
+		}
+		return map[string]any{
+			"output_type": "error",
+			"ename":       c.Error.Ename,
+			"evalue":      c.Error.Evalue,
+			"traceback":   traceback,
+		}
+	}
+	return nil
+}
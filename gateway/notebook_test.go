@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExportNotebook(t *testing.T) {
+	k := &Kernel{Name: "python3"}
+	cells := []string{"print('hi'); 42", "1/0", "never run"}
+	outputs := [][]*Content{
+		{
+			{Type: "stream", Name: "stdout", Text: "hi\n"},
+			{Type: "execute_result", ExecutionCount: 1, Data: &Data{Plaintext: "42"}},
+			{Type: "execute_reply", Status: "ok", ExecutionCount: 1},
+		},
+		{
+			{Type: "error", Error: &Error{Ename: "ZeroDivisionError", Evalue: "division by zero"}},
+			{Type: "execute_reply", Status: "error", ExecutionCount: 2},
+		},
+	}
+	b, err := k.ExportNotebook(cells, outputs)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	var nb struct {
+		Format   int `json:"nbformat"`
+		Metadata struct {
+			Kernelspec struct {
+				Name string `json:"name"`
+			} `json:"kernelspec"`
+		} `json:"metadata"`
+		Cells []struct {
+			Type    string           `json:"cell_type"`
+			Count   *int             `json:"execution_count"`
+			Source  string           `json:"source"`
+			Outputs []map[string]any `json:"outputs"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(b, &nb); err != nil {
+		t.Fatalf("Failed to unmarshal notebook: %v", err)
+	}
+	if nb.Format != 4 || nb.Metadata.Kernelspec.Name != "python3" {
+		t.Fatalf("Expected nbformat 4 with the kernelspec, got %s", b)
+	}
+	if len(nb.Cells) != 3 {
+		t.Fatalf("Expected 3 cells, got %d", len(nb.Cells))
+	}
+
+	first := nb.Cells[0]
+	if first.Type != "code" || first.Source != cells[0] || first.Count == nil || *first.Count != 1 {
+		t.Fatalf("Unexpected first cell: %+v", first)
+	}
+	if len(first.Outputs) != 2 {
+		t.Fatalf("Expected the stream, and the result, got %v", first.Outputs)
+	}
+	if o := first.Outputs[0]; o["output_type"] != "stream" || o["text"] != "hi\n" {
+		t.Fatalf("Unexpected stream output: %v", o)
+	}
+	if o := first.Outputs[1]; o["output_type"] != "execute_result" || o["data"].(map[string]any)["text/plain"] != "42" {
+		t.Fatalf("Unexpected result output: %v", o)
+	}
+
+	second := nb.Cells[1]
+	if len(second.Outputs) != 1 || second.Outputs[0]["ename"] != "ZeroDivisionError" {
+		t.Fatalf("Expected the error output, got %v", second.Outputs)
+	}
+	if tb, ok := second.Outputs[0]["traceback"].([]any); !ok || len(tb) != 0 {
+		t.Fatalf("Expected an empty traceback list, got %v", second.Outputs[0]["traceback"])
+	}
+
+	if last := nb.Cells[2]; last.Count != nil || len(last.Outputs) != 0 {
+		t.Fatalf("Expected the cell never run to have no count, or outputs, got %+v", last)
+	}
+
+	if _, err := k.ExportNotebook(cells[:1], outputs); err == nil {
+		t.Fatalf("Expected an error for more outputs than cells")
+	}
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ExecuteResult is the outcome of an execution, as opposed to the outputs
+// that were streamed along the way.
+type ExecuteResult struct {
+	Status         string
+	ExecutionCount int
+	Data           *Data // execute_result, if any
+	Error          *Error
+	Duration       time.Duration
+}
+
+// Run executes the code, and waits for the result.
+//
+// The outputs are sent to the stream as they arrive, unless it's nil; the
+// stream is not closed. The result is returned even if the execution had
+// failed, in which case the Error is set; the returned error is reserved
+// for failures to execute at all.
+func (k *Kernel) Run(ctx context.Context, code string, stream chan<- *Content) (*ExecuteResult, error) {
+	start := time.Now()
+	h, err := k.submit(ctx, code, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the outputs that follow the early return must not stall the read loop
+	defer k.abandon(h.sub)
+	ch := h.sub.ch
+
+	r := &ExecuteResult{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case c, ok := <-ch:
+			if !ok {
+				return nil, errClosed
+			}
+			switch {
+			case c.Type == "execute_reply":
+				r.Status = c.Status
+				r.ExecutionCount = c.ExecutionCount
+				r.Error = c.Error
+				r.Duration = c.Duration
+				if r.Duration == 0 {
+					r.Duration = time.Since(start)
+				}
+				return r, nil
+			case c.Type == "execute_result":
+				r.Data = c.Data
+			case c.Error != nil && c.Error.err != nil:
+				return nil, c.Error
+			}
+			if stream == nil {
+				continue
+			}
+			select {
+			case stream <- c:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+// Eval runs the code, and returns the printed text, followed by the text
+// of the result, if any; should the code raise, the Error is returned.
+func (k *Kernel) Eval(ctx context.Context, code string) (string, error) {
+	var (
+		b      strings.Builder
+		stream = make(chan *Content)
+		done   = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for c := range stream {
+			if c.Type == "stream" {
+				b.WriteString(c.Text)
+			}
+		}
+	}()
+	r, err := k.Run(ctx, code, stream)
+	close(stream)
+	<-done
+	if err != nil {
+		return "", err
+	}
+	if r.Error != nil {
+		return b.String(), r.Error
+	}
+	if r.Data != nil {
+		if s, ok := r.Data.Text(); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String(), nil
+}
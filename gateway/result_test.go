@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+)
+
+func TestEval(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		switch code {
+		case "1/0":
+			return gatewaytest.Reply{Error: &gatewaytest.Error{
+				Ename:  "ZeroDivisionError",
+				Evalue: "division by zero",
+			}}
+		default:
+			return gatewaytest.Reply{
+				Stdout: "answer: ",
+				Result: map[string]any{"text/plain": "42"},
+			}
+		}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	s, err := k.Eval(ctx, "print('answer: ', end=''); 42")
+	if err != nil {
+		t.Fatalf("Failed to eval: %v", err)
+	}
+	if s != "answer: 42" {
+		t.Fatalf("Expected the printed, and returned text, got %q", s)
+	}
+
+	_, err = k.Eval(ctx, "1/0")
+	var e *Error
+	if !errors.As(err, &e) || e.Ename != "ZeroDivisionError" {
+		t.Fatalf("Expected the Python error, got %v", err)
+	}
+}
+
+func TestAborted(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Aborted: code == "interrupted"}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	r, err := k.Run(ctx, "interrupted", nil)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Status != "aborted" || r.Error == nil || r.Error.Kind() != AbortedError {
+		t.Fatalf("Expected the execution aborted, got %s %v", r.Status, r.Error)
+	}
+	if !errors.Is(r.Error, ErrAborted) {
+		t.Fatalf("Expected ErrAborted, got %v", r.Error)
+	}
+	if r, _ := k.Run(ctx, "completed", nil); r.Status != "ok" || r.Error != nil {
+		t.Fatalf("Expected the execution completed, got %s %v", r.Status, r.Error)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Chunks: slices.Repeat([]string{"."}, 16)}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u, BufferSize: 2}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	rctx, cancel := context.WithCancel(ctx)
+	stream := make(chan *Content)
+	done := make(chan error, 1)
+	go func() {
+		_, err := k.Run(rctx, "for _ in range(16): print('.')", stream)
+		done <- err
+	}()
+	<-stream
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the run cancelled, got %v", err)
+	}
+
+	// the rest of the outputs must not stall the read loop
+	tctx, tcancel := context.WithTimeout(ctx, time.Second)
+	defer tcancel()
+	if _, err := k.Info(tctx); err != nil {
+		t.Fatalf("Expected the kernel to answer, got %v", err)
+	}
+	if !k.Alive(tctx) {
+		t.Fatal("Expected the kernel alive")
+	}
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Result: map[string]any{"text/markdown": code}}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{
+		Name:             "python3",
+		URL:              u,
+		MarkdownRenderer: strings.ToUpper,
+	}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	r, err := k.Run(ctx, "# title", nil)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Data == nil || r.Data.Markdown != "# TITLE" {
+		t.Fatalf("Expected the markdown rendered, got %+v", r.Data)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	var restored string
+	snapshot := "8:c3RhdGU="
+	srv.Exec = func(code string) gatewaytest.Reply {
+		switch {
+		case strings.Contains(code, "__cablectl_snapshot"):
+			return gatewaytest.Reply{Stdout: snapshot}
+		case strings.Contains(code, "__cablectl_restore"):
+			restored = code
+		}
+		return gatewaytest.Reply{}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	b, err := k.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if string(b) != "state" {
+		t.Fatalf("Expected the decoded snapshot, got %q", b)
+	}
+	if err := k.Restore(ctx, b); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if !strings.Contains(restored, "'c3RhdGU='") {
+		t.Fatalf("Expected the snapshot in the restore code, got %q", restored)
+	}
+
+	snapshot = "12:c3RhdGU=" // the rest dropped by the rate limit
+	if _, err := k.Snapshot(ctx); !errors.Is(err, ErrSnapshotTruncated) {
+		t.Fatalf("Expected the snapshot truncated, got %v", err)
+	}
+}
+
+func TestUnknownMIME(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Result: map[string]any{
+			"application/vnd.custom+json": map[string]any{"answer": 42},
+		}}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	r, err := k.Run(ctx, "custom()", nil)
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if r.Data.IsEmpty() {
+		t.Fatalf("Expected the unknown representation delivered")
+	}
+	if types := r.Data.MIMETypes(); !slices.Equal(types, []string{"application/vnd.custom+json"}) {
+		t.Fatalf("Unexpected MIME types: %v", types)
+	}
+	if s, _ := r.Data.Get("application/vnd.custom+json"); s != `{"answer":42}` {
+		t.Fatalf("Expected the raw bundle, got %s", s)
+	}
+	if !(&Data{}).IsEmpty() || !(*Data)(nil).IsEmpty() {
+		t.Fatalf("Expected the empty data")
+	}
+}
@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrSnapshotTruncated is returned when the snapshot didn't come through in
+// full, most likely due to the IOPub data rate limit of the server.
+var ErrSnapshotTruncated = errors.New("snapshot truncated")
+
+// snapshotCode pickles the user namespace with dill, variable by variable,
+// skipping the private names, and whatever fails to pickle. The base64 is
+// prefixed with its length, so that the truncation is detected.
+const snapshotCode = `def __cablectl_snapshot():
+    import base64, dill
+    state = {}
+    for name, value in list(globals().items()):
+        if name.startswith('_') or name in ('In', 'Out', 'exit', 'quit', 'get_ipython'):
+            continue
+        try:
+            state[name] = dill.dumps(value)
+        except Exception:
+            pass
+    b = base64.b64encode(dill.dumps(state)).decode()
+    print(f'{len(b)}:{b}', end='')
+try:
+    __cablectl_snapshot()
+finally:
+    del __cablectl_snapshot`
+
+// restoreCode unpickles the snapshot into the user namespace; %s is the
+// base64 of the snapshot.
+const restoreCode = `def __cablectl_restore(b):
+    import base64, dill
+    state = dill.loads(base64.b64decode(b))
+    for name, value in state.items():
+        try:
+            globals()[name] = dill.loads(value)
+        except Exception:
+            pass
+try:
+    __cablectl_restore('%s')
+finally:
+    del __cablectl_restore`
+
+// Snapshot pickles the variables of the kernel namespace, so that the state
+// may later be restored, in this, or another kernel, to branch the execution.
+//
+// Since the kernels cannot be forked, this is approximate: the variables that
+// dill cannot pickle, such as open files, or sockets, are left out. The kernel
+// must have dill installed.
+//
+// The snapshot is printed over IOPub, which the server rate-limits, by default
+// to 1MB/s averaged over 3 seconds, dropping the output beyond that; so unless
+// the limit is raised, e.g. with --ServerApp.iopub_data_rate_limit, snapshots
+// of more than a few megabytes fail with ErrSnapshotTruncated.
+func (k *Kernel) Snapshot(ctx context.Context) ([]byte, error) {
+	s, err := k.Eval(ctx, snapshotCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot kernel: %w", err)
+	}
+	size, s, _ := strings.Cut(s, ":")
+	if n, err := strconv.Atoi(size); err != nil || n != len(s) {
+		return nil, fmt.Errorf("failed to snapshot kernel: %w", ErrSnapshotTruncated)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return b, nil
+}
+
+// Restore loads the Snapshot into the kernel namespace, on top of the
+// variables that are already defined.
+func (k *Kernel) Restore(ctx context.Context, snapshot []byte) error {
+	code := fmt.Sprintf(restoreCode, base64.StdEncoding.EncodeToString(snapshot))
+	if _, err := k.Eval(ctx, code); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
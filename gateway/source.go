@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxSource is the largest source that's sent as one cell; the message has
+// to fit in memory on both ends, and the gateway would choke on more.
+const maxSource = 64 << 20
+
+// ErrSourceTooLarge is returned for the source larger than 64 MiB.
+var ErrSourceTooLarge = errors.New("source is too large")
+
+// ExecuteFile reads the source file, and executes it as one cell.
+func (k *Kernel) ExecuteFile(ctx context.Context, path string) (chan *Content, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return k.ExecuteReader(ctx, f)
+}
+
+// ExecuteReader reads the source, and executes it as one cell.
+//
+// The source is expected in UTF-8, or otherwise UTF-16, with the byte order
+// mark; the read is abandoned, should the context be done.
+func (k *Kernel) ExecuteReader(ctx context.Context, r io.Reader) (chan *Content, error) {
+	b, err := io.ReadAll(io.LimitReader(ctxReader{ctx, r}, maxSource+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	if len(b) > maxSource {
+		return nil, ErrSourceTooLarge
+	}
+	code, err := decodeSource(b)
+	if err != nil {
+		return nil, err
+	}
+	return k.Execute(ctx, code)
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// decodeSource strips the byte order mark, if any, and decodes UTF-16.
+func decodeSource(b []byte) (string, error) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		b = b[3:]
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	}
+	if order == nil {
+		if !utf8.Valid(b) {
+			return "", fmt.Errorf("source is not valid UTF-8")
+		}
+		return string(b), nil
+	}
+	b = b[2:]
+	if len(b)%2 != 0 {
+		return "", fmt.Errorf("source is not valid UTF-16")
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u)), nil
+}
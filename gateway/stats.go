@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KernelStats is a snapshot of the activity on the kernel, over the lifetime
+// of the Kernel, across the reconnects.
+type KernelStats struct {
+	Executions   int64
+	Messages     map[string]int64 // received, by type
+	Streamed     int64            // bytes of stream text
+	Reconnects   int64
+	LastActivity time.Time // of the last message received
+}
+
+type stats struct {
+	executions atomic.Int64
+	streamed   atomic.Int64
+	reconnects atomic.Int64
+	last       atomic.Int64 // unix nanoseconds
+
+	mu       sync.Mutex
+	messages map[string]int64
+}
+
+func (s *stats) received(msgType string) {
+	s.last.Store(time.Now().UnixNano())
+	s.mu.Lock()
+	if s.messages == nil {
+		s.messages = make(map[string]int64)
+	}
+	s.messages[msgType]++
+	s.mu.Unlock()
+}
+
+// Stats returns the snapshot of the kernel activity.
+func (k *Kernel) Stats() KernelStats {
+	s := KernelStats{
+		Executions: k.stats.executions.Load(),
+		Streamed:   k.stats.streamed.Load(),
+		Reconnects: k.stats.reconnects.Load(),
+	}
+	if last := k.stats.last.Load(); last != 0 {
+		s.LastActivity = time.Unix(0, last)
+	}
+	k.stats.mu.Lock()
+	s.Messages = maps.Clone(k.stats.messages)
+	k.stats.mu.Unlock()
+	if s.Messages == nil {
+		s.Messages = map[string]int64{}
+	}
+	return s
+}
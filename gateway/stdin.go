@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoInput is returned by Input when the kernel isn't awaiting input.
+var ErrNoInput = errors.New("no input requested")
+
+// prompt delivers the input_request, and remembers it for the reply.
+func (k *Kernel) prompt(m *Message) error {
+	var c Content
+	if err := m.Unmarshal(&c); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", m.Type, err)
+	}
+	c.Type = m.Type
+	c.Channel = m.Channel
+	c.Message = m.Parent()
+
+	k.mu.Lock()
+	k.input = m.Header
+	k.mu.Unlock()
+	k.deliver(&c)
+	return nil
+}
+
+// Input answers the pending input_request of an execution, see AllowStdin.
+func (k *Kernel) Input(value string) error {
+	k.mu.Lock()
+	h := k.input
+	k.input = nil
+	k.mu.Unlock()
+	if h == nil {
+		return ErrNoInput
+	}
+
+	m, err := k.message("stdin", "input_reply", map[string]any{
+		"value": value,
+	})
+	if err != nil {
+		return err
+	}
+	m.ParentHeader = h
+	return k.send(m)
+}
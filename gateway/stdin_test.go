@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+)
+
+func TestInput(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Input: "name: ", Stdout: "hello, "}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u, AllowStdin: true}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	prompts := k.SubscribeChannel("stdin")
+	ch, err := k.Execute(ctx, "input('name: ')")
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	if c := <-prompts; c.Type != "input_request" || c.Prompt != "name: " {
+		t.Fatalf("Expected input_request, got %s %q", c.Type, c.Prompt)
+	}
+	if err := k.Input("pirate"); err != nil {
+		t.Fatalf("Failed to input: %v", err)
+	}
+
+	var stdout string
+	for c := range ch {
+		switch c.Type {
+		case "input_request":
+		case "stream":
+			stdout += c.Text
+			if c.Channel != "iopub" {
+				t.Fatalf("Expected stream on iopub, got %q", c.Channel)
+			}
+		case "execute_reply":
+			if c.Channel != "shell" {
+				t.Fatalf("Expected execute_reply on shell, got %q", c.Channel)
+			}
+		}
+	}
+	if stdout != "hello, pirate" {
+		t.Fatalf("Unexpected stdout: %q", stdout)
+	}
+	if err := k.Input("again"); err != ErrNoInput {
+		t.Fatalf("Expected ErrNoInput, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// streamKey identifies the stream of an execution.
+type streamKey struct {
+	parent uuid.UUID
+	name   string
+}
+
+// complete makes the stream text end on a rune boundary.
+//
+// The kernels may split a multibyte sequence between the stream messages,
+// so the incomplete tail is held back until the next message of the same
+// stream; the text is decoded from the raw message, as the JSON decoder
+// would replace the partial sequences. It's only called from the read loop.
+func (k *Kernel) complete(m *Message, c *Content) {
+	var raw struct {
+		Text json.RawMessage `json:"text"`
+	}
+	if err := m.Unmarshal(&raw); err != nil {
+		return
+	}
+	b, ok := unquote(raw.Text)
+	if !ok {
+		return
+	}
+	key := streamKey{c.Message, c.Name}
+	if k.tails == nil {
+		k.tails = map[streamKey][]byte{}
+	}
+	b = append(k.tails[key], b...)
+	cut := len(b)
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if cut < len(b) {
+		k.tails[key] = append([]byte(nil), b[cut:]...)
+	} else {
+		delete(k.tails, key)
+	}
+	c.Text = strings.ToValidUTF8(string(b[:cut]), "�")
+}
+
+// leftovers returns the incomplete tails of the finished execution.
+func (k *Kernel) leftovers(parent uuid.UUID) []*Content {
+	var cc []*Content
+	for key, tail := range k.tails {
+		if key.parent != parent {
+			continue
+		}
+		delete(k.tails, key)
+		cc = append(cc, &Content{
+			Message: parent,
+			Type:    "stream",
+			Channel: "iopub",
+			Name:    key.name,
+			Text:    strings.ToValidUTF8(string(tail), "�"),
+		})
+	}
+	return cc
+}
+
+// unquote decodes the JSON string, keeping the invalid UTF-8 bytes as-is.
+func unquote(s []byte) ([]byte, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return nil, false
+	}
+	s = s[1 : len(s)-1]
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return nil, false
+		}
+		switch s[i] {
+		case '"', '\\', '/':
+			b = append(b, s[i])
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'u':
+			r, ok := hex4(s[i+1:])
+			if !ok {
+				return nil, false
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), false
+				if i+2 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					r2, ok = hex4(s[i+3:])
+				}
+				if r = utf16.DecodeRune(r, r2); ok && r != utf8.RuneError {
+					i += 6
+				}
+			}
+			b = utf8.AppendRune(b, r)
+		default:
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+func hex4(s []byte) (rune, bool) {
+	if len(s) < 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(s[:4]), 16, 16)
+	return rune(n), err == nil
+}
+
+// AssembleStream concatenates the stream texts among the contents, as they
+// would be displayed in the notebook: a carriage return starts the line
+// over, unless it's followed by a newline, and a backspace erases the last
+// character, so that the progress bars are readable.
+func AssembleStream(contents []*Content) string {
+	var s strings.Builder
+	for _, c := range contents {
+		if c.Type == "stream" {
+			s.WriteString(c.Text)
+		}
+	}
+	text := []rune(s.String())
+
+	var out strings.Builder
+	var line []rune
+	for i, r := range text {
+		switch r {
+		case '\n':
+			out.WriteString(string(line))
+			out.WriteRune('\n')
+			line = line[:0]
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			line = line[:0]
+		case '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			line = append(line, r)
+		}
+	}
+	out.WriteString(string(line))
+	return out.String()
+}
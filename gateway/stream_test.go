@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStreamRunes(t *testing.T) {
+	k := &Kernel{BufferSize: 8, ctx: context.Background()}
+	ch := k.Subscribe("stream")
+
+	parent := &Header{ID: uuid.NewString()}
+	stream := func(text string) {
+		err := k.handle(&Message{
+			Channel:      "iopub",
+			Type:         "stream",
+			ParentHeader: parent,
+			Content:      []byte(`{"name":"stdout","text":"` + text + `"}`),
+		})
+		if err != nil {
+			t.Fatalf("Failed to handle stream: %v", err)
+		}
+	}
+	// "héllo, 🌍" split in the middle of the runes
+	stream("h\xc3")
+	stream("\xa9llo, \xf0\x9f")
+	stream("\x8c\x8d\\n")
+
+	var text string
+	for range 3 {
+		text += (<-ch).Text
+	}
+	if text != "héllo, 🌍\n" {
+		t.Fatalf("Unexpected text: %q", text)
+	}
+	if len(k.tails) != 0 {
+		t.Fatalf("Expected no tails left, got %v", k.tails)
+	}
+}
+
+func TestAssembleStream(t *testing.T) {
+	stream := func(texts ...string) []*Content {
+		cc := []*Content{{Type: "execute_reply"}}
+		for _, text := range texts {
+			cc = append(cc, &Content{Type: "stream", Name: "stderr", Text: text})
+		}
+		return cc
+	}
+	for _, tc := range []struct {
+		in   []*Content
+		want string
+	}{
+		{stream("a\nb"), "a\nb"},
+		{stream("  0%|", "\r 50%|##", "\r100%|####\n", "done"), "100%|####\ndone"},
+		{stream("windows\r", "\nline"), "windows\nline"},
+		{stream("abc\b\bd"), "ad"},
+		{stream("\b\rx"), "x"},
+	} {
+		if got := AssembleStream(tc.in); got != tc.want {
+			t.Errorf("Expected %q, got %q", tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var errClosed = errors.New("kernel connection is closed")
+
+// subscription is a filtered view of the contents from the read loop.
+type subscription struct {
+	ch       chan *Content
+	types    []string      // all, if empty
+	channels []string      // all, if empty
+	id       uuid.UUID     // if set, only this request, until its execute_reply
+	gone     chan struct{} // closed once the consumer is, see abandon
+	once     sync.Once
+}
+
+func (s *subscription) match(c *Content) bool {
+	if c.Error != nil && c.Error.err != nil && c.Message == uuid.Nil {
+		return true // connection errors concern everyone
+	}
+	if s.id != uuid.Nil && c.Message != s.id {
+		return false
+	}
+	if len(s.channels) > 0 && !slices.Contains(s.channels, c.Channel) {
+		return false
+	}
+	return len(s.types) == 0 || slices.Contains(s.types, c.Type)
+}
+
+// Subscribe returns a stream of contents of the given message types, i.e.
+// "stream", or "error"; with no types given, all contents are delivered.
+//
+// The channel is closed along with the connection.
+func (k *Kernel) Subscribe(types ...string) <-chan *Content {
+	return k.subscribe(&subscription{types: types}).ch
+}
+
+// SubscribeChannel returns a stream of contents that arrived on the given
+// channels, i.e. "iopub", "shell", or "stdin".
+//
+// The channel is closed along with the connection.
+func (k *Kernel) SubscribeChannel(channels ...string) <-chan *Content {
+	return k.subscribe(&subscription{channels: channels}).ch
+}
+
+func (k *Kernel) subscribe(sub *subscription) *subscription {
+	sub.ch = make(chan *Content, k.BufferSize)
+	sub.gone = make(chan struct{})
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		close(sub.ch)
+		return sub
+	}
+	k.subs = append(k.subs, sub)
+	return sub
+}
+
+func (k *Kernel) unsubscribe(sub *subscription) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.subs = slices.DeleteFunc(k.subs, func(s *subscription) bool {
+		return s == sub
+	})
+}
+
+// abandon drops the subscription, whose consumer is gone, so that the read
+// loop wouldn't wait on it; the channel is left to be collected.
+func (k *Kernel) abandon(sub *subscription) {
+	k.unsubscribe(sub)
+	sub.once.Do(func() { close(sub.gone) })
+}
+
+// deliver fans out the content to the matching subscriptions.
+//
+// Execution subscriptions are closed after their execute_reply.
+func (k *Kernel) deliver(c *Content) {
+	k.mu.Lock()
+	subs := slices.Clone(k.subs)
+	k.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.match(c) {
+			continue
+		}
+		k.push(sub, c)
+		if sub.id != uuid.Nil && c.Type == "execute_reply" {
+			k.unsubscribe(sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// push sends the content to the subscriber; in DropOldest mode it never
+// blocks, and makes room by discarding the oldest buffered content.
+//
+// The executions are never dropped from, as they would never complete,
+// unless they are abandoned altogether.
+func (k *Kernel) push(sub *subscription, c *Content) {
+	if !k.DropOldest || sub.id != uuid.Nil {
+		select {
+		case sub.ch <- c:
+		case <-sub.gone:
+		case <-k.ctx.Done():
+		}
+		return
+	}
+	for {
+		select {
+		case sub.ch <- c:
+			return
+		default:
+		}
+		select {
+		case <-sub.ch:
+			k.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// teardown closes all of the subscriptions, once the read loop stops.
+func (k *Kernel) teardown() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, sub := range k.subs {
+		close(sub.ch)
+	}
+	if !k.listening {
+		close(k.out)
+	}
+	k.subs = nil
+	k.closed = true
+	k.broadcast()
+}
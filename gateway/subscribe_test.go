@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/busthorne/cablectl/gateway/gatewaytest"
+)
+
+// collect drains the channel until it's closed.
+func collect(ch <-chan *Content) []string {
+	var types []string
+	for c := range ch {
+		types = append(types, c.Type)
+	}
+	return types
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Stdout: "hi", Result: map[string]any{"text/plain": "1"}}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	all, streams, shell := k.Subscribe(), k.Subscribe("stream"), k.SubscribeChannel("shell")
+	if _, err := k.Run(ctx, "print('hi'); 1", nil); err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	k.Close()
+
+	for _, sub := range []struct {
+		name string
+		ch   <-chan *Content
+		want []string
+	}{
+		{"all", all, []string{"stream", "execute_result", "execute_reply"}},
+		{"streams", streams, []string{"stream"}},
+		{"shell", shell, []string{"execute_reply"}},
+	} {
+		if got := collect(sub.ch); !slices.Equal(got, sub.want) {
+			t.Errorf("Expected %s to get %v, got %v", sub.name, sub.want, got)
+		}
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	var chunks []string
+	for i := range 10 {
+		chunks = append(chunks, strconv.Itoa(i))
+	}
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Chunks: chunks}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u, BufferSize: 2, DropOldest: true}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	// never read until the execution is over
+	slow := k.Subscribe("stream")
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := k.Run(tctx, "count()", nil); err != nil {
+		t.Fatalf("Expected the slow subscriber not to hold up the execution, got %v", err)
+	}
+	if n := k.Dropped(); n != 8 {
+		t.Fatalf("Expected 8 contents dropped, got %d", n)
+	}
+	if a, b := <-slow, <-slow; a.Text != "8" || b.Text != "9" {
+		t.Fatalf("Expected the latest contents kept, got %q, %q", a.Text, b.Text)
+	}
+}
+
+func TestAbandonDuringDelivery(t *testing.T) {
+	ctx := context.Background()
+	srv := gatewaytest.NewServer()
+	defer srv.Close()
+	srv.Exec = func(code string) gatewaytest.Reply {
+		return gatewaytest.Reply{Chunks: slices.Repeat([]string{"."}, 16)}
+	}
+	u, _ := url.Parse(srv.URL)
+	k := &Kernel{Name: "python3", URL: u, BufferSize: 1}
+	if err := NewKernel(ctx, k); err != nil {
+		t.Fatalf("Failed to create kernel: %v", err)
+	}
+	defer k.Close()
+
+	watcher := k.Subscribe("stream")
+	h, err := k.Start(ctx, "for _ in range(16): print('.')")
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	// the read loop is stuck on the execution, which nobody reads
+	<-watcher
+	k.abandon(h.sub)
+
+	timeout := time.After(time.Second)
+	for n := 1; n < 16; n++ {
+		select {
+		case <-watcher:
+		case <-timeout:
+			t.Fatalf("Expected the rest delivered once abandoned, got %d of 16", n)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Subprotocol is the binary websocket protocol of newer Jupyter Server.
+//
+// The message parts are framed with offsets, as opposed to being a single
+// JSON document, so the buffers don't have to be base64-encoded.
+//
+// https://jupyter-server.readthedocs.io/en/latest/developers/websocket-protocols.html
+const Subprotocol = "v1.kernel.websocket.jupyter.org"
+
+var errFraming = errors.New("malformed v1 message framing")
+
+// encodeV1 frames the message as follows:
+//
+//	offset_number | offset_0 | ... | offset_n |
+//	channel | header | parent_header | metadata | content | buffer_0 | ...
+//
+// All integers are 64-bit little-endian; offsets are from the start of the
+// message, and the last one is the end of the message.
+func encodeV1(m *Message) ([]byte, error) {
+	parts := [][]byte{[]byte(m.Channel)}
+	c := codec.Get()
+	for _, v := range []any{m.Header, m.ParentHeader, m.Metadata} {
+		b, err := c.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, b)
+	}
+	content := m.Content
+	if content == nil {
+		content = json.RawMessage("{}")
+	}
+	parts = append(parts, content)
+	for i, buf := range m.Buffers {
+		b, ok := buf.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("buffer %d: expected []byte, got %T", i, buf)
+		}
+		parts = append(parts, b)
+	}
+
+	n := len(parts) + 1
+	offset := 8 * (n + 1)
+	size := offset
+	for _, p := range parts {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint64(b, uint64(n))
+	b = binary.LittleEndian.AppendUint64(b, uint64(offset))
+	for _, p := range parts {
+		offset += len(p)
+		b = binary.LittleEndian.AppendUint64(b, uint64(offset))
+	}
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b, nil
+}
+
+func decodeV1(b []byte) (*Message, error) {
+	if len(b) < 8 {
+		return nil, errFraming
+	}
+	n := binary.LittleEndian.Uint64(b)
+	if n < 6 || n > uint64(len(b))/8-1 {
+		return nil, errFraming
+	}
+	offsets := make([]uint64, n)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint64(b[8*(i+1):])
+		if offsets[i] > uint64(len(b)) || i > 0 && offsets[i] < offsets[i-1] {
+			return nil, errFraming
+		}
+	}
+	part := func(i int) []byte {
+		return b[offsets[i]:offsets[i+1]]
+	}
+
+	c := codec.Get()
+	m := &Message{Channel: string(part(0))}
+	if err := c.Unmarshal(part(1), &m.Header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if err := c.Unmarshal(part(2), &m.ParentHeader); err != nil {
+		return nil, fmt.Errorf("parent header: %w", err)
+	}
+	if err := c.Unmarshal(part(3), &m.Metadata); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	m.Content = json.RawMessage(part(4))
+	for i := 5; i < len(offsets)-1; i++ {
+		m.Buffers = append(m.Buffers, part(i))
+	}
+	if h := m.Header; h != nil {
+		m.ID, m.Type = h.ID, h.Type
+	}
+	return m, nil
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWireV1(t *testing.T) {
+	m := &Message{
+		Header: &Header{
+			ID:      "6f1c",
+			Type:    "display_data",
+			Session: "cable",
+			Version: "5.3",
+		},
+		ParentHeader: &Header{ID: "1a2b"},
+		Channel:      "iopub",
+		Content:      []byte(`{"data":{"text/plain":"42"}}`),
+		Metadata:     map[string]any{},
+		Buffers:      []any{[]byte("\x89PNG")},
+	}
+
+	b, err := encodeV1(m)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	got, err := decodeV1(b)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	switch {
+	case got.Channel != "iopub":
+		t.Fatalf("Channel mismatch: %q", got.Channel)
+	case got.ID != "6f1c" || got.Type != "display_data":
+		t.Fatalf("Header mismatch: %+v", got.Header)
+	case got.ParentHeader.ID != "1a2b":
+		t.Fatalf("Parent header mismatch: %+v", got.ParentHeader)
+	case !bytes.Equal(got.Content, m.Content):
+		t.Fatalf("Content mismatch: %s", got.Content)
+	case len(got.Buffers) != 1 || !bytes.Equal(got.Buffers[0].([]byte), []byte("\x89PNG")):
+		t.Fatalf("Buffers mismatch: %v", got.Buffers)
+	}
+
+	if _, err := decodeV1(b[:20]); err == nil {
+		t.Fatal("Expected truncated message to fail")
+	}
+}
@@ -0,0 +1,43 @@
+// Package jsoncodec holds the pluggable JSON implementation of a package.
+package jsoncodec
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Codec is encoding/json, or a drop-in replacement, such as jsoniter, or
+// sonic, which honours the json.Marshaler, and json.Unmarshaler.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type std struct{}
+
+func (std) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (std) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// Std is encoding/json.
+var Std Codec = std{}
+
+// Value is the codec in use, Std by default; it's safe for concurrent use.
+type Value struct {
+	p atomic.Pointer[Codec]
+}
+
+// Set replaces the codec; nil restores Std.
+func (v *Value) Set(c Codec) {
+	if c == nil {
+		v.p.Store(nil)
+		return
+	}
+	v.p.Store(&c)
+}
+
+func (v *Value) Get() Codec {
+	if p := v.p.Load(); p != nil {
+		return *p
+	}
+	return Std
+}
@@ -0,0 +1,26 @@
+// Package useragent provides the default User-Agent of the clients.
+package useragent
+
+import "runtime/debug"
+
+const module = "github.com/busthorne/cablectl"
+
+// Default is cablectl/<version>, as per the build info of the module, or
+// cablectl/devel, if it's unknown, i.e. in the tests.
+var Default = "cablectl/" + version()
+
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if info.Main.Path == module && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == module && dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "devel"
+}
@@ -0,0 +1,58 @@
+package langfuse
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// Capture is an in-memory sink for the batched events.
+//
+// It's intended for testing the code that emits traces: instead of being
+// sent upstream, the events are recorded, so you could assert on them.
+type Capture struct {
+	events []Ingestible
+	mu     sync.Mutex
+}
+
+// Capture switches the client to capture mode, and returns the sink.
+//
+// From then on, the batches are never sent; every event is acknowledged.
+func (c *Client) Capture() *Capture {
+	sink := &Capture{}
+	c.capture.Store(sink)
+	return sink
+}
+
+// Events returns the events captured so far, in order.
+func (s *Capture) Events() []Ingestible {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Ingestible(nil), s.events...)
+}
+
+// Reset discards the captured events.
+func (s *Capture) Reset() {
+	s.mu.Lock()
+	s.events = nil
+	s.mu.Unlock()
+}
+
+func (s *Capture) record(events []*envelope) *api.IngestionResponse {
+	s.mu.Lock()
+	s.events = append(s.events, bodies(events)...)
+	s.mu.Unlock()
+
+	ack := &api.IngestionResponse{
+		Successes: make([]api.IngestionSuccess, len(events)),
+		Errors:    []api.IngestionError{},
+	}
+	for i, e := range events {
+		ack.Successes[i] = api.IngestionSuccess{
+			Id:     e.Id,
+			Status: http.StatusCreated,
+		}
+	}
+	return ack
+}
@@ -0,0 +1,14 @@
+package langfuse
+
+import "github.com/busthorne/cablectl/internal/jsoncodec"
+
+// Codec is the JSON implementation of the ingestion batches, see SetCodec.
+type Codec = jsoncodec.Codec
+
+var codec jsoncodec.Value
+
+// SetCodec replaces encoding/json with the codec for the ingestion batches,
+// and their acknowledgements; nil restores encoding/json.
+func SetCodec(c Codec) {
+	codec.Set(c)
+}
@@ -0,0 +1,47 @@
+package langfuse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// DeleteTrace deletes the trace, along with its observations, and scores;
+// the trace that doesn't exist, or was already deleted, is not an error.
+//
+// Langfuse deletes the traces asynchronously, so they may still be listed
+// for a while.
+func (c *Client) DeleteTrace(ctx context.Context, id string) error {
+	return c.deleted("trace", func() (*http.Response, error) {
+		return c.API.TraceDelete(ctx, id)
+	})
+}
+
+// DeleteTraces deletes the traces at once, see DeleteTrace.
+func (c *Client) DeleteTraces(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.deleted("traces", func() (*http.Response, error) {
+		return c.API.TraceDeleteMultiple(ctx, api.TraceDeleteMultipleJSONRequestBody{TraceIds: ids})
+	})
+}
+
+// deleted performs the deletion, treating the missing resource as deleted.
+func (c *Client) deleted(what string, do func() (*http.Response, error)) error {
+	resp, err := do()
+	if err != nil {
+		return fmt.Errorf("langfuse: delete %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200, 202, 204, 404:
+		return nil
+	case 401:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("langfuse: delete %s failed with status: %s", what, resp.Status)
+	}
+}
@@ -0,0 +1,162 @@
+package langfuse
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+	"github.com/google/uuid"
+)
+
+// envelope is a single occurrence of the event in the ingestion batch.
+//
+// Every time an event is ingested, it's assigned a unique envelope id, which
+// Langfuse uses for deduplication. The id is kept across the retries, so that
+// the events resent after a failure that actually succeeded upstream are not
+// duplicated, while the creates and updates of the same observation, which
+// share the event id, never collide.
+//
+// The envelopes are numbered in the order of ingestion, since the create
+// and update of an observation may well share the timestamp; the batches
+// are sent in that order, and the number is included in the metadata.
+type envelope struct {
+	Id        string     `json:"id"`
+	Type      EventType  `json:"type"`
+	Timestamp millis     `json:"timestamp"`
+	Metadata  sequence   `json:"metadata"`
+	Body      Ingestible `json:"body"`
+}
+
+type sequence struct {
+	Seq uint64 `json:"seq"`
+}
+
+var seq atomic.Uint64
+
+func wrap(event Ingestible) *envelope {
+	return &envelope{
+		Id:        uuid.New().String(),
+		Type:      event.EventType(),
+		Timestamp: millis(time.Now()),
+		Metadata:  sequence{Seq: seq.Add(1)},
+		Body:      event,
+	}
+}
+
+// ordered sorts the envelopes in the order of ingestion, except that the
+// observations ingested ahead of their parents, i.e. the trace, or another
+// observation, are held back until right after them, lest Langfuse warn of
+// the parents not found.
+func ordered(envs []*envelope) []*envelope {
+	type rank struct {
+		after uint64 // seq of the envelope, or its first ancestor, if later
+		depth int
+	}
+	first := make(map[string]*envelope, len(envs))
+	for _, env := range envs {
+		if _, ok := env.Body.(*traceUpdate); ok {
+			continue // of the trace created before
+		}
+		id := env.Body.EventId()
+		if f, ok := first[id]; !ok || env.Metadata.Seq < f.Metadata.Seq {
+			first[id] = env
+		}
+	}
+	ranks := make(map[*envelope]rank, len(envs))
+	var rankOf func(env *envelope, n int) rank
+	rankOf = func(env *envelope, n int) rank {
+		if r, ok := ranks[env]; ok {
+			return r
+		}
+		r := rank{after: env.Metadata.Seq}
+		if p, ok := first[lineage(env.Body)]; ok && n < len(envs) {
+			pr := rankOf(p, n+1)
+			r = rank{after: max(r.after, pr.after), depth: pr.depth + 1}
+		}
+		ranks[env] = r
+		return r
+	}
+	return slices.SortedStableFunc(slices.Values(envs), func(a, b *envelope) int {
+		ra, rb := rankOf(a, 0), rankOf(b, 0)
+		return cmp.Or(
+			cmp.Compare(ra.after, rb.after),
+			cmp.Compare(ra.depth, rb.depth),
+			cmp.Compare(a.Metadata.Seq, b.Metadata.Seq),
+		)
+	})
+}
+
+// dependencies returns, for every chunk of size of the ordered envelopes,
+// the earlier chunks that it must not be sent before: those with the first
+// envelope of its events, or of their parents.
+func dependencies(envs []*envelope, size int) [][]int {
+	deps := make([][]int, (len(envs)+size-1)/size)
+	first := make(map[string]int, len(envs)) // chunk, by event
+	for i, env := range envs {
+		n, id := i/size, env.Body.EventId()
+		for _, dep := range []string{id, lineage(env.Body)} {
+			if m, ok := first[dep]; ok && m < n && !slices.Contains(deps[n], m) {
+				deps[n] = append(deps[n], m)
+			}
+		}
+		if _, ok := first[id]; !ok {
+			first[id] = n
+		}
+	}
+	return deps
+}
+
+// lineage returns the id of the parent of the event: the observation, or
+// otherwise the trace, or none, for the trace itself.
+func lineage(event Ingestible) string {
+	if g, ok := event.(guarded); ok {
+		mu := g.guard()
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	switch e := event.(type) {
+	case *Span:
+		return cmp.Or(e.ParentObservationId, e.TraceId)
+	case *Generation:
+		return cmp.Or(e.ParentObservationId, e.TraceId)
+	case *Event:
+		return cmp.Or(e.ParentObservationId, e.TraceId)
+	case *Observation:
+		return cmp.Or(e.ParentObservationId, e.TraceId)
+	case *Score:
+		return cmp.Or(e.ObservationId, e.TraceId)
+	}
+	return ""
+}
+
+func bodies(envs []*envelope) []Ingestible {
+	events := make([]Ingestible, len(envs))
+	for i, env := range envs {
+		events[i] = env.Body
+	}
+	return events
+}
+
+// reconcile rewrites the envelope ids in the acknowledgement to the event ids,
+// and returns the envelopes that failed, in the order of the errors.
+func reconcile(ack *api.IngestionResponse, envs []*envelope) []*envelope {
+	index := make(map[string]*envelope, len(envs))
+	for _, env := range envs {
+		index[env.Id] = env
+	}
+	for i, s := range ack.Successes {
+		if env, ok := index[s.Id]; ok {
+			ack.Successes[i].Id = env.Body.EventId()
+		}
+	}
+	failed := make([]*envelope, len(ack.Errors))
+	for i, e := range ack.Errors {
+		if env, ok := index[e.Id]; ok {
+			ack.Errors[i].Id = env.Body.EventId()
+			failed[i] = env
+		}
+	}
+	return failed
+}
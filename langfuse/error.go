@@ -3,21 +3,108 @@ package langfuse
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/busthorne/cablectl/langfuse/api"
 )
 
 var ErrBatchFailed = errors.New("langfuse: batch ingestion failed")
 
+// ErrUnauthorized is returned when Langfuse rejects the keys.
+var ErrUnauthorized = errors.New("langfuse: unauthorized")
+
+// UnsentError reports the events of the batch that were not delivered, as
+// the context was done before their chunks were sent, or the requests had
+// failed altogether.
+type UnsentError struct {
+	Err error
+
+	unsent []*envelope
+}
+
+func (e *UnsentError) Error() string {
+	return fmt.Sprintf("langfuse: %d events not sent: %v", len(e.unsent), e.Err)
+}
+
+func (e *UnsentError) Unwrap() error {
+	return e.Err
+}
+
+// Unsent returns the events that were not sent, in order.
+func (e *UnsentError) Unsent() []Ingestible {
+	return bodies(e.unsent)
+}
+
 type BatchError struct {
 	Errors []api.IngestionError `json:"errors"`
+
+	failed []*envelope // along the errors, if known
 }
 
+// Error summarizes the first few failures, one per line.
 func (e *BatchError) Error() string {
-	return fmt.Sprintf("langfuse: %d events failed to ingest", len(e.Errors))
+	const summarized = 3
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "langfuse: %d events failed to ingest", len(e.Errors))
+	for i, ie := range e.Errors {
+		if i == summarized {
+			fmt.Fprintf(&b, "\n\t... and %d more", len(e.Errors)-summarized)
+			break
+		}
+		fmt.Fprintf(&b, "\n\t%s: %d", ie.Id, ie.Status)
+		switch {
+		case ie.Message != nil:
+			fmt.Fprintf(&b, " %s", *ie.Message)
+		case ie.Error != nil:
+			fmt.Fprintf(&b, " %v", *ie.Error)
+		}
+	}
+	return b.String()
 }
 
 // Unwrap allows the error to be checked with errors.Is without type assertion
 func (e *BatchError) Unwrap() error {
 	return ErrBatchFailed
 }
+
+// FailedIDs returns the ids of the events that failed to ingest.
+func (e *BatchError) FailedIDs() []string {
+	ids := make([]string, len(e.Errors))
+	for i, ie := range e.Errors {
+		ids[i] = ie.Id
+	}
+	return ids
+}
+
+// ByStatus returns the failures with the given status code.
+func (e *BatchError) ByStatus(code int) []api.IngestionError {
+	var errs []api.IngestionError
+	for _, ie := range e.Errors {
+		if ie.Status == code {
+			errs = append(errs, ie)
+		}
+	}
+	return errs
+}
+
+// Retryable returns the failed events of the batch that may succeed if
+// sent again, i.e. the ones rejected due to rate limiting, or server-side
+// errors, as opposed to the invalid ones.
+func (e *BatchError) Retryable() []Ingestible {
+	return bodies(e.retryable())
+}
+
+func (e *BatchError) retryable() []*envelope {
+	var envs []*envelope
+	for i, ie := range e.Errors {
+		if i >= len(e.failed) || e.failed[i] == nil {
+			continue
+		}
+		if ie.Status == http.StatusTooManyRequests || ie.Status >= 500 {
+			envs = append(envs, e.failed[i])
+		}
+	}
+	return envs
+}
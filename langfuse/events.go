@@ -1,6 +1,8 @@
 package langfuse
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,6 +30,14 @@ func (t *Trace) EventId() string      { return t.Id }
 func (t *Trace) EventType() EventType { return TRACE_CREATE }
 func (t *Trace) EventTime() time.Time { return t.Timestamp }
 
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	type trace Trace
+	return codec.Get().Marshal(struct {
+		*trace
+		Timestamp millis `json:"timestamp"`
+	}{(*trace)(t), millis(t.Timestamp)})
+}
+
 func (t *Trace) Span(s *Span) *Span {
 	if s == nil {
 		panic("langfuse: Span cannot be nil when calling Trace.Span")
@@ -49,6 +59,29 @@ func (t *Trace) Span(s *Span) *Span {
 	return s
 }
 
+func (t *Trace) Generation(g *Generation) *Generation {
+	if g == nil {
+		panic("langfuse: Generation cannot be nil when calling Trace.Generation")
+	}
+	if t.client == nil {
+		panic("langfuse: Trace must be associated with a client before creating a Generation")
+	}
+
+	g.TraceId = t.Id
+	if g.Id == "" {
+		g.Id = uuid.New().String()
+	}
+	if g.StartedAt.IsZero() {
+		g.StartedAt = time.Now().UTC()
+	}
+	if g.Version == "" && t.Version != "" {
+		g.Version = t.Version
+	}
+
+	t.client.Ingest(g)
+	return g
+}
+
 func (t *Trace) Event(e *Event) *Event {
 	if e == nil {
 		panic("langfuse: Event cannot be nil when calling Trace.Event")
@@ -87,11 +120,19 @@ type Span struct {
 	Version             string     `json:"version,omitempty"`
 	Environment         string     `json:"environment,omitempty"`
 
+	// HideInput, and HideOutput, see Generation.
+	HideInput  bool `json:"-"`
+	HideOutput bool `json:"-"`
+
 	client *Client `json:"-"`
+	mu     sync.Mutex
+	ended  bool
 }
 
 func (s *Span) EventId() string { return s.Id }
 func (s *Span) EventType() EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.EndedAt == nil {
 		return SPAN_CREATE
 	}
@@ -99,9 +140,50 @@ func (s *Span) EventType() EventType {
 }
 func (s *Span) EventTime() time.Time { return s.StartedAt }
 
+func (s *Span) MarshalJSON() ([]byte, error) {
+	type span Span
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return codec.Get().Marshal(struct {
+		*span
+		StartedAt millis  `json:"startTime"`
+		EndedAt   *millis `json:"endTime,omitempty"`
+		Input     any     `json:"input,omitempty"`
+		Output    any     `json:"output,omitempty"`
+	}{(*span)(s), millis(s.StartedAt), ms(s.EndedAt), shown(s.Input, s.HideInput), shown(s.Output, s.HideOutput)})
+}
+
+func (s *Span) guard() *sync.Mutex { return &s.mu }
+
+// End ends the span, and ingests the update; it's safe to call from
+// multiple goroutines, but only the first call has any effect.
 func (s *Span) End() {
+	s.EndContext(context.Background())
+}
+
+// EndContext ends the span, and ingests the update; should that trigger
+// the automatic flush, it's done within the context.
+func (s *Span) EndContext(ctx context.Context) error {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return nil
+	}
+	s.ended = true
 	now := time.Now().UTC()
 	s.EndedAt = &now
+	s.mu.Unlock()
+	return s.client.IngestContext(ctx, s)
+}
+
+// Update changes the span, and ingests the update.
+//
+// The fields of the span that's shared between goroutines must only be
+// changed this way, as the span may be concurrently encoded by Flush.
+func (s *Span) Update(fn func(*Span)) {
+	s.mu.Lock()
+	fn(s)
+	s.mu.Unlock()
 	s.client.Ingest(s)
 }
 
@@ -129,6 +211,14 @@ func (s *Span) Generation(g *Generation) *Generation {
 	return g
 }
 
+// Generations records the parallel model calls of the span at once.
+func (s *Span) Generations(gs ...*Generation) []*Generation {
+	for _, g := range gs {
+		s.Generation(g)
+	}
+	return gs
+}
+
 func (s *Span) Span(childSpan *Span) *Span {
 	if childSpan == nil {
 		panic("langfuse: child Span cannot be nil when calling Span.Span")
@@ -194,13 +284,73 @@ type Generation struct {
 	ParentObservationId string             `json:"parentObservationId,omitempty"`
 	Version             string             `json:"version,omitempty"`
 	Environment         string             `json:"environment,omitempty"`
+
+	// HideInput, and HideOutput, leave the field out of what's sent, e.g.
+	// to record that the generation happened, but not its sensitive output;
+	// the generation itself keeps it. They are RecordInput, and RecordOutput,
+	// inverted, so that the zero value records the fields, as before.
+	HideInput  bool `json:"-"`
+	HideOutput bool `json:"-"`
+
+	client *Client `json:"-"`
+	mu     sync.Mutex
+	ended  bool
 }
 
-func (g *Generation) EventId() string      { return g.Id }
-func (g *Generation) EventType() EventType { return GENERATION_CREATE }
+func (g *Generation) EventId() string { return g.Id }
+func (g *Generation) EventType() EventType {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.EndedAt == nil {
+		return GENERATION_CREATE
+	}
+	return GENERATION_UPDATE
+}
 func (g *Generation) EventTime() time.Time { return g.StartedAt }
 
+func (g *Generation) MarshalJSON() ([]byte, error) {
+	type generation Generation
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return codec.Get().Marshal(struct {
+		*generation
+		StartedAt    millis  `json:"startTime"`
+		EndedAt      *millis `json:"endTime,omitempty"`
+		CompletionAt *millis `json:"completionStartTime,omitempty"`
+		Input        any     `json:"input,omitempty"`
+		Output       any     `json:"output,omitempty"`
+	}{(*generation)(g), millis(g.StartedAt), ms(g.EndedAt), ms(g.CompletionAt), shown(g.Input, g.HideInput), shown(g.Output, g.HideOutput)})
+}
+
+func (g *Generation) guard() *sync.Mutex { return &g.mu }
+
+// End ends the generation, see EndContext; only the first call has any
+// effect.
 func (g *Generation) End() {
+	g.EndContext(context.Background())
+}
+
+// Update changes the generation, and ingests the update, if it's associated
+// with a client; see Span.Update.
+func (g *Generation) Update(fn func(*Generation)) {
+	g.mu.Lock()
+	fn(g)
+	g.mu.Unlock()
+	if g.client != nil {
+		g.client.Ingest(g)
+	}
+}
+
+// EndContext ends the generation, and ingests the update, if it's associated
+// with a client; should that trigger the automatic flush, it's done within
+// the context.
+func (g *Generation) EndContext(ctx context.Context) error {
+	g.mu.Lock()
+	if g.ended {
+		g.mu.Unlock()
+		return nil
+	}
+	g.ended = true
 	now := time.Now().UTC()
 	if g.EndedAt == nil {
 		g.EndedAt = &now
@@ -208,6 +358,11 @@ func (g *Generation) End() {
 	if g.CompletionAt == nil {
 		g.CompletionAt = &g.StartedAt
 	}
+	g.mu.Unlock()
+	if g.client == nil {
+		return nil
+	}
+	return g.client.IngestContext(ctx, g)
 }
 
 type Event struct {
@@ -223,8 +378,87 @@ type Event struct {
 	ParentObservationId string    `json:"parentObservationId,omitempty"`
 	Version             string    `json:"version,omitempty"`
 	Environment         string    `json:"environment,omitempty"`
+
+	// HideInput, and HideOutput, see Generation.
+	HideInput  bool `json:"-"`
+	HideOutput bool `json:"-"`
 }
 
 func (e *Event) EventId() string      { return e.Id }
 func (e *Event) EventType() EventType { return EVENT_CREATE }
 func (e *Event) EventTime() time.Time { return e.StartTime }
+
+func (e *Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return codec.Get().Marshal(struct {
+		*event
+		StartTime millis `json:"startTime"`
+		Input     any    `json:"input,omitempty"`
+		Output    any    `json:"output,omitempty"`
+	}{(*event)(e), millis(e.StartTime), shown(e.Input, e.HideInput), shown(e.Output, e.HideOutput)})
+}
+
+// ObservationKind selects the type of the raw Observation.
+type ObservationKind string
+
+const (
+	KindSpan       ObservationKind = "SPAN"
+	KindGeneration ObservationKind = "GENERATION"
+	KindEvent      ObservationKind = "EVENT"
+)
+
+// Observation is the raw observation, covering the fields of all kinds;
+// it's the escape hatch for the flows that the typed builders don't cover.
+//
+// It's ingested as created, unless Update is set.
+type Observation struct {
+	Id                  string             `json:"id"`
+	TraceId             string             `json:"traceId,omitempty"`
+	Kind                ObservationKind    `json:"type"`
+	Name                string             `json:"name,omitempty"`
+	StartTime           time.Time          `json:"startTime,omitzero"`
+	EndTime             *time.Time         `json:"endTime,omitempty"`
+	CompletionStartTime *time.Time         `json:"completionStartTime,omitempty"`
+	Model               string             `json:"model,omitempty"`
+	ModelParameters     map[string]any     `json:"modelParameters,omitempty"`
+	Usage               any                `json:"usage,omitempty"`
+	UsageDetails        any                `json:"usageDetails,omitempty"`
+	CostDetails         map[string]float64 `json:"costDetails,omitempty"`
+	PromptName          string             `json:"promptName,omitempty"`
+	PromptVersion       *int               `json:"promptVersion,omitempty"`
+	Metadata            any                `json:"metadata,omitempty"`
+	Input               any                `json:"input,omitempty"`
+	Output              any                `json:"output,omitempty"`
+	Level               string             `json:"level,omitempty"`
+	StatusMessage       string             `json:"statusMessage,omitempty"`
+	ParentObservationId string             `json:"parentObservationId,omitempty"`
+	Version             string             `json:"version,omitempty"`
+	Environment         string             `json:"environment,omitempty"`
+
+	// HideInput, and HideOutput, see Generation.
+	HideInput  bool `json:"-"`
+	HideOutput bool `json:"-"`
+
+	Update bool `json:"-"`
+}
+
+func (o *Observation) EventId() string { return o.Id }
+func (o *Observation) EventType() EventType {
+	if o.Update {
+		return OBSERVATION_UPDATE
+	}
+	return OBSERVATION_CREATE
+}
+func (o *Observation) EventTime() time.Time { return o.StartTime }
+
+func (o *Observation) MarshalJSON() ([]byte, error) {
+	type observation Observation
+	return codec.Get().Marshal(struct {
+		*observation
+		StartTime           millis  `json:"startTime,omitzero"`
+		EndTime             *millis `json:"endTime,omitempty"`
+		CompletionStartTime *millis `json:"completionStartTime,omitempty"`
+		Input               any     `json:"input,omitempty"`
+		Output              any     `json:"output,omitempty"`
+	}{(*observation)(o), millis(o.StartTime), ms(o.EndTime), ms(o.CompletionStartTime), shown(o.Input, o.HideInput), shown(o.Output, o.HideOutput)})
+}
@@ -0,0 +1,48 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// Health checks that Langfuse is up, and accepts the keys, and returns the
+// status, and version of the server; the keys rejected are ErrUnauthorized.
+//
+// Call it at startup to fail fast on the wrong host, or keys, as opposed to
+// finding out on the first flush.
+func (c *Client) Health(ctx context.Context) (*api.HealthResponse, error) {
+	resp, err := c.API.HealthHealth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("langfuse: health: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+	case 401:
+		return nil, ErrUnauthorized
+	default:
+		return nil, fmt.Errorf("langfuse: health failed with status: %s", resp.Status)
+	}
+	var health api.HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("langfuse: health decode: %w", err)
+	}
+
+	// the health endpoint is public, so the keys are checked separately
+	resp, err = c.API.ProjectsGet(ctx)
+	if err != nil {
+		return &health, fmt.Errorf("langfuse: health: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+		return &health, nil
+	case 401:
+		return &health, ErrUnauthorized
+	default:
+		return &health, fmt.Errorf("langfuse: get project failed with status: %s", resp.Status)
+	}
+}
@@ -2,16 +2,22 @@ package langfuse
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/busthorne/cablectl/backoff"
+	"github.com/busthorne/cablectl/internal/useragent"
 	"github.com/busthorne/cablectl/langfuse/api"
 	"github.com/google/uuid"
 )
@@ -57,8 +63,18 @@ type Ingestible interface {
 type Client struct {
 	API *api.Client
 
-	ingestibles []Ingestible
-	mu          sync.Mutex
+	opts    ClientOptions
+	buffer  []*envelope
+	mu      sync.Mutex
+	capture atomic.Pointer[Capture]
+
+	pmu       sync.Mutex
+	projectId string
+	prompts   sync.Map // last fetched, for the fallback
+
+	rmu     sync.Mutex
+	rollups map[string]*list.Element // of traceCosts, by trace
+	recent  *list.List               // the traces most recently flushed first
 }
 
 // ClientOptions are the determining the API line for this package.
@@ -67,12 +83,59 @@ type Client struct {
 // sane defaults for transport, dialer, and timeouts. If you wish to
 // control these variables, you absolutely should provide your own
 // client.
+//
+// Large batches are split into chunks of BatchSize events, of which up
+// to Concurrency are sent in parallel. A chunk with the updates, or the
+// children of the events in the earlier chunks is only sent once those
+// are, so that the order of ingestion holds. By default, a batch is sent
+// in a single request.
+//
+// Inputs, outputs, and metadata larger than MaxFieldBytes, if set, are
+// truncated upon ingestion, so that a single huge generation wouldn't
+// have the whole batch rejected as too large.
+//
+// DefaultTags are added to every trace; the tags are deduplicated.
+//
+// Once FlushAt events are buffered, if set, they are flushed automatically.
+//
+// The Project id, if set, is used for the links to the traces; otherwise,
+// it's looked up, see ProjectID.
+//
+// With RollupCosts, every flush updates the traces of the generations with
+// their total cost, and usage, in the metadata; the totals are kept for the
+// last thousand traces flushed.
 type ClientOptions struct {
 	Host       string
 	PrivateKey string
 	PublicKey  string
+	Project    string
+
+	HTTPClient  *http.Client
+	Metrics     Metrics
+	BatchSize   int
+	Concurrency int
+
+	MaxFieldBytes int
+	DefaultTags   []string
+	FlushAt       int
+	RollupCosts   bool
+
+	// Retries is how many times a batch that failed altogether, i.e. due
+	// to the network, or the server, is retried within the flush, waiting
+	// as per Backoff, or backoff.Default, before the events are buffered
+	// again for the next flush.
+	Retries int
+	Backoff backoff.Backoff
+
+	// UserAgent is sent with every request, including the media uploads;
+	// defaults to cablectl/<version>.
+	UserAgent string
 
-	HTTPClient *http.Client
+	// OnConnection, if set, is called as every request gets its connection,
+	// telling whether it was reused; should the connections not be reused
+	// under load, the ephemeral ports run out. The transport of your own
+	// HTTPClient is given at least Concurrency idle connections per host.
+	OnConnection func(httptrace.GotConnInfo)
 }
 
 // New creates a client from code-generated API client implementation.
@@ -94,6 +157,18 @@ func New(opts *ClientOptions) (*Client, error) {
 		return nil, errors.New("langfuse: private key is required")
 	}
 
+	if opts.Metrics == nil {
+		opts.Metrics = nopMetrics{}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = backoff.Default
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = useragent.Default
+	}
 	if opts.HTTPClient == nil {
 		opts.HTTPClient = &http.Client{
 			Transport: &http.Transport{
@@ -116,6 +191,7 @@ func New(opts *ClientOptions) (*Client, error) {
 			Timeout: keepAlive,
 		}
 	}
+	opts.HTTPClient = pooled(opts.HTTPClient, opts.Concurrency)
 
 	b := []byte(opts.PublicKey + ":" + opts.PrivateKey)
 	h := "Basic " + base64.StdEncoding.EncodeToString(b)
@@ -123,27 +199,90 @@ func New(opts *ClientOptions) (*Client, error) {
 		req.Header.Set("Authorization", h)
 		return nil
 	}
+	userAgent := func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("User-Agent", opts.UserAgent)
+		return nil
+	}
+	client := &Client{
+		opts:   *opts,
+		buffer: make([]*envelope, 0, 64),
+		mu:     sync.Mutex{},
+
+		projectId: opts.Project,
+	}
 	api, err := api.NewClient(opts.Host,
 		api.WithBaseURL(opts.Host),
-		api.WithRequestEditorFn(basicAuth))
+		api.WithHTTPClient(opts.HTTPClient),
+		api.WithRequestEditorFn(basicAuth),
+		api.WithRequestEditorFn(userAgent),
+		api.WithRequestEditorFn(client.traced))
 	if err != nil {
 		return nil, fmt.Errorf("langfuse: %w", err)
 	}
-
-	client := &Client{
-		API:         api,
-		ingestibles: make([]Ingestible, 0, 64),
-		mu:          sync.Mutex{},
-	}
+	client.API = api
 	return client, nil
 }
 
 // Ingest adds an ingestible to the client's buffer, after populating it.
+//
+// Every ingestion is a distinct event to Langfuse, deduplicated by its own
+// id, which is kept when the event is retried; so the events are never
+// duplicated by Flush retries, while the creates and updates of the same
+// observation never collide.
 func (c *Client) Ingest(event Ingestible) {
-	c.Populate(event)
+	c.IngestContext(context.Background(), event)
+}
+
+// IngestContext is like Ingest, but the automatic flush that it may trigger,
+// is done within the context; its error is returned.
+func (c *Client) IngestContext(ctx context.Context, event Ingestible) error {
+	var changed []string
+	if g, ok := event.(guarded); ok {
+		mu := g.guard()
+		mu.Lock()
+		c.populate(event)
+		c.truncate(event)
+		changed = normalize(event)
+		mu.Unlock()
+	} else {
+		c.populate(event)
+		c.truncate(event)
+		changed = normalize(event)
+	}
+	if t, ok := event.(*Trace); ok {
+		t.Tags = dedupe(c.opts.DefaultTags, t.Tags)
+	}
 	c.mu.Lock()
-	c.ingestibles = append(c.ingestibles, event)
+	c.buffer = append(c.buffer, wrap(event))
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		c.buffer = append(c.buffer, wrap(newLog(map[string]any{
+			"message":       "unsupported model parameters were normalized",
+			"observationId": event.EventId(),
+			"parameters":    changed,
+		})))
+	}
+	full := c.opts.FlushAt > 0 && len(c.buffer) >= c.opts.FlushAt
 	c.mu.Unlock()
+	if full {
+		return c.Flush(ctx)
+	}
+	return nil
+}
+
+// dedupe merges the tags, keeping the first occurrence of each.
+func dedupe(tags ...[]string) []string {
+	var merged []string
+	seen := map[string]bool{}
+	for _, tt := range tags {
+		for _, tag := range tt {
+			if !seen[tag] {
+				seen[tag] = true
+				merged = append(merged, tag)
+			}
+		}
+	}
+	return merged
 }
 
 // Populate populates the traces and spans with the client.
@@ -152,52 +291,211 @@ func (c *Client) Ingest(event Ingestible) {
 // the database metadata column, or for inputs that didn't originate
 // from the client directly.
 func (c *Client) Populate(event Ingestible) {
+	if g, ok := event.(guarded); ok {
+		mu := g.guard()
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	c.populate(event)
+}
+
+// guarded observations may be shared between goroutines, so their fields
+// are only accessed under the lock.
+type guarded interface {
+	guard() *sync.Mutex
+}
+
+func (c *Client) populate(event Ingestible) {
 	switch e := event.(type) {
 	case *Trace:
 		e.client = c
 	case *Span:
-		e.client = c
+		if e.client != c {
+			e.client = c
+		}
+	case *Generation:
+		if e.client != c {
+			e.client = c
+		}
 	}
 }
 
 // Batch submits a series of ingestibles to the upstream API.
-func (c *Client) Batch(ctx context.Context, events []Ingestible) error {
-	bodies := make([]map[string]any, len(events))
-	for i := range events {
-		bodies[i] = map[string]any{
-			"id":        events[i].EventId(),
-			"type":      events[i].EventType(),
-			"timestamp": events[i].EventTime(),
-			"body":      events[i],
+//
+// The events are sent in chunks, in parallel, according to the client
+// options; once the context is cancelled, no further chunks are sent.
+// Partial failures of all chunks are reported as a single BatchError,
+// whereas the events of the chunks that were not sent at all, be it due
+// to the context, or the failed requests, are reported as UnsentError.
+//
+// The response combines the acknowledgements of all chunks, so that the
+// accepted events can be reconciled by their ids.
+func (c *Client) Batch(ctx context.Context, events []Ingestible) (*api.IngestionResponse, error) {
+	envs := make([]*envelope, len(events))
+	for i, event := range events {
+		envs[i] = wrap(event)
+	}
+	return c.send(ctx, envs)
+}
+
+// send submits the envelopes in chunks, see Batch.
+func (c *Client) send(ctx context.Context, events []*envelope) (*api.IngestionResponse, error) {
+	ack := &api.IngestionResponse{
+		Successes: []api.IngestionSuccess{},
+		Errors:    []api.IngestionError{},
+	}
+	if len(events) == 0 {
+		return ack, nil
+	}
+	events = ordered(events)
+	size := c.opts.BatchSize
+	if size <= 0 || size > len(events) {
+		size = len(events)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		sem  = make(chan struct{}, c.opts.Concurrency)
+		errs []error
+		sent = make([]bool, (len(events)+size-1)/size) // by chunk
+		done = make([]chan struct{}, len(sent))
+		deps = dependencies(events, size)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	record := func(n int, resp *api.IngestionResponse, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if resp != nil {
+			ack.Successes = append(ack.Successes, resp.Successes...)
+			ack.Errors = append(ack.Errors, resp.Errors...)
+		}
+		if err != nil && !errors.Is(err, ErrBatchFailed) {
+			errs = append(errs, err)
+			return
+		}
+		sent[n] = true
+	}
+dispatch:
+	for i := 0; i < len(events); i += size {
+		n, chunk := i/size, events[i:min(i+size, len(events))]
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			break dispatch
+		}
+		done[n] = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[n])
+			defer func() { <-sem }()
+			for _, m := range deps[n] {
+				select {
+				case <-done[m]:
+				case <-ctx.Done():
+					fail(ctx.Err())
+					return
+				}
+				mu.Lock()
+				ok := sent[m]
+				mu.Unlock()
+				if !ok {
+					return // left unsent, along with its dependency
+				}
+			}
+			resp, err := c.batch(ctx, chunk)
+			record(n, resp, err)
+		}()
+	}
+	wg.Wait()
+
+	failed := reconcile(ack, events)
+	var err error
+	if len(errs) > 0 {
+		unsent := &UnsentError{Err: errors.Join(errs...)}
+		for n, ok := range sent {
+			if !ok {
+				unsent.unsent = append(unsent.unsent, events[n*size:min((n+1)*size, len(events))]...)
+			}
+		}
+		err = unsent
+	}
+	if len(ack.Errors) > 0 {
+		err = errors.Join(err, &BatchError{Errors: ack.Errors, failed: failed})
+	}
+	return ack, err
+}
+
+// batch submits a single chunk of events.
+func (c *Client) batch(ctx context.Context, events []*envelope) (ack *api.IngestionResponse, err error) {
+	defer func() {
+		c.opts.Metrics.Batched(len(events), err)
+	}()
+	if sink := c.capture.Load(); sink != nil {
+		return sink.record(events), nil
+	}
+
+	body, err := encodeBatch(events)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		ack, retry, err = c.ingest(ctx, body)
+		if !retry || attempt >= c.opts.Retries || ctx.Err() != nil {
+			return ack, err
+		}
+		if err := backoff.Sleep(ctx, c.opts.Backoff, attempt); err != nil {
+			return nil, fmt.Errorf("langfuse: batch ingest: %w", err)
 		}
 	}
+}
 
-	var b bytes.Buffer
-	err := json.NewEncoder(&b).Encode(map[string]any{"batch": bodies})
+// encodeBatch encodes the envelopes as the ingestion request body.
+func encodeBatch(events []*envelope) ([]byte, error) {
+	b, err := codec.Get().Marshal(map[string]any{"batch": events})
 	if err != nil {
-		return fmt.Errorf("langfuse: batch encode: %w", err)
+		return nil, fmt.Errorf("langfuse: batch encode: %w", err)
 	}
+	return b, nil
+}
 
-	resp, err := c.API.IngestionBatchWithBody(ctx, "application/json", &b)
+// ingest makes a single attempt at the batch, and tells whether the failure
+// is worth retrying, i.e. it's not the events that were rejected.
+func (c *Client) ingest(ctx context.Context, body []byte) (*api.IngestionResponse, bool, error) {
+	resp, err := c.API.IngestionBatchWithBody(ctx, "application/json", bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("langfuse: batch ingest: %w", err)
+		return nil, true, fmt.Errorf("langfuse: batch ingest: %w", err)
 	}
 	defer resp.Body.Close()
 
 	switch resp.StatusCode {
-	case 200, 201:
-		return nil
-	case 207:
-		var ing api.IngestionResponse
-		if err := json.NewDecoder(resp.Body).Decode(&ing); err != nil {
-			return fmt.Errorf("langfuse: batch ingest decode: %w", err)
+	case 200, 201, 207:
+		ack := &api.IngestionResponse{}
+		b, err := io.ReadAll(resp.Body)
+		if err == nil && len(bytes.TrimSpace(b)) > 0 {
+			err = codec.Get().Unmarshal(b, ack)
 		}
-		if len(ing.Errors) > 0 {
-			return &BatchError{Errors: ing.Errors}
+		if err != nil {
+			return nil, false, fmt.Errorf("langfuse: batch ingest decode: %w", err)
 		}
-		return nil
+		if len(ack.Errors) > 0 {
+			return ack, false, &BatchError{Errors: ack.Errors}
+		}
+		return ack, false, nil
 	default:
-		return fmt.Errorf("langfuse: batch ingest failed with status: %s", resp.Status)
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("langfuse: batch ingest failed with status: %s", resp.Status)
 	}
 }
 
@@ -218,26 +516,58 @@ func (c *Client) Trace(t *Trace) *Trace {
 // Flush will batch all ingestibles remaining in the client's buffer.
 //
 // You would typically `defer client.Flush()`.
+//
+// If the batch fails, the events are buffered again to be retried on the
+// next flush, except for the ones rejected by Langfuse as invalid; should
+// the context be done mid-flush, only the chunks not yet sent are.
 func (c *Client) Flush(ctx context.Context) error {
-	if len(c.ingestibles) == 0 {
-		return nil
-	}
+	_, err := c.FlushN(ctx)
+	return err
+}
 
+// FlushN is Flush, returning the number of events ingested successfully.
+func (c *Client) FlushN(ctx context.Context) (int, error) {
 	c.mu.Lock()
-	eventsToFlush := make([]Ingestible, len(c.ingestibles))
-	copy(eventsToFlush, c.ingestibles)
-	c.ingestibles = make([]Ingestible, 0, len(eventsToFlush))
+	if len(c.buffer) == 0 {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	eventsToFlush := make([]*envelope, len(c.buffer))
+	copy(eventsToFlush, c.buffer)
+	c.buffer = make([]*envelope, 0, len(eventsToFlush))
 	c.mu.Unlock()
+	if c.opts.RollupCosts {
+		eventsToFlush = append(eventsToFlush, c.rollup(eventsToFlush)...)
+	}
 
-	switch err := c.Batch(ctx, eventsToFlush); {
-	case err == nil:
-		return nil
-	case errors.Is(err, ErrBatchFailed):
-		return err
-	default:
+	ack, err := c.send(ctx, eventsToFlush)
+	n := len(ack.Successes)
+	if err == nil {
+		return n, nil
+	}
+	var (
+		retry     []*envelope
+		unsentErr *UnsentError
+		batchErr  *BatchError
+	)
+	if errors.As(err, &unsentErr) {
+		retry = append(retry, unsentErr.unsent...)
+	}
+	if errors.As(err, &batchErr) {
+		retry = append(retry, batchErr.retryable()...)
+	}
+	if len(retry) > 0 {
 		c.mu.Lock()
-		c.ingestibles = append(eventsToFlush, c.ingestibles...) // preserve order
+		c.buffer = append(retry, c.buffer...) // preserve order
 		c.mu.Unlock()
-		return err
+		c.opts.Metrics.Retried(len(retry))
 	}
+	return n, err
+}
+
+// Pending returns the number of events buffered, yet to be flushed.
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.buffer)
 }
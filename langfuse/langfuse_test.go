@@ -0,0 +1,1061 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/busthorne/cablectl/backoff"
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ClientOptions) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	opts.Host = srv.URL
+	opts.PublicKey = "pk-lf-test"
+	opts.PrivateKey = "sk-lf-test"
+	c, err := New(&opts)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	const n = 4
+
+	var inflight, peak, requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		cur := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}, ClientOptions{BatchSize: 2, Concurrency: n})
+
+	events := make([]Ingestible, 32)
+	for i := range events {
+		events[i] = &Event{Id: "event", StartTime: time.Now()}
+	}
+	if _, err := c.Batch(context.Background(), events); err != nil {
+		t.Fatalf("Failed to batch: %v", err)
+	}
+	if got := requests.Load(); got != 16 {
+		t.Fatalf("Expected 16 requests, got %d", got)
+	}
+	if got := peak.Load(); got < n-1 || got > n {
+		t.Fatalf("Expected ~%d requests in flight, got %d", n, got)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request in capture mode: %s %s", r.Method, r.URL)
+	}, ClientOptions{})
+	sink := c.Capture()
+
+	trace := c.Trace(&Trace{Name: "capture"})
+	span := trace.Span(&Span{Name: "step"})
+	span.End()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	events := sink.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if events[0] != trace || events[1] != span {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{MaxFieldBytes: 32})
+
+	input := strings.Repeat("ж", 100)
+	span := &Span{Input: input, Output: "ok", Metadata: map[string]any{"k": "v"}}
+	c.Ingest(span)
+
+	got, ok := span.Input.(string)
+	if !ok || len(got) > 32 || !strings.HasSuffix(got, TruncatedMarker) {
+		t.Fatalf("Expected input truncated to 32 bytes, got %q", span.Input)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatalf("Truncated input is not valid UTF-8: %q", got)
+	}
+	if span.Output != "ok" {
+		t.Fatalf("Expected output untouched, got %v", span.Output)
+	}
+	md := span.Metadata.(map[string]any)
+	if md["k"] != "v" {
+		t.Fatalf("Expected metadata preserved, got %v", md)
+	}
+	sizes := md["truncated"].(map[string]int)
+	if sizes["input"] != len(input) {
+		t.Fatalf("Expected original input size %d, got %v", len(input), sizes)
+	}
+
+	c.Ingest(span)
+	if span.Input != got {
+		t.Fatalf("Expected truncation to be idempotent, got %q", span.Input)
+	}
+}
+
+func TestSpanContext(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	upstream := c.Trace(&Trace{Name: "upstream"}).Span(&Span{Name: "call"})
+	header, err := upstream.Context().MarshalText()
+	if err != nil {
+		t.Fatalf("Failed to marshal span context: %v", err)
+	}
+	sc, err := ParseSpanContext(string(header))
+	if err != nil {
+		t.Fatalf("Failed to parse span context: %v", err)
+	}
+	if sc != upstream.Context() {
+		t.Fatalf("Expected %v, got %v", upstream.Context(), sc)
+	}
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	sink.Reset()
+	child := c.SpanFromContext(sc).Span(&Span{Name: "downstream"})
+	if child.TraceId != upstream.TraceId || child.ParentObservationId != upstream.Id {
+		t.Fatalf("Expected child of %v, got trace %s, parent %s",
+			sc, child.TraceId, child.ParentObservationId)
+	}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if events := sink.Events(); len(events) != 1 || events[0] != child {
+		t.Fatalf("Expected only the child ingested, got %v", events)
+	}
+}
+
+func TestSpanFromCtx(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	c.Capture()
+
+	trace := c.Trace(&Trace{Name: "stack"})
+	ctx := trace.Into(context.Background())
+	outer := c.SpanFromCtx(ctx, &Span{Name: "outer"})
+	if outer.TraceId != trace.Id || outer.ParentObservationId != "" {
+		t.Fatalf("Expected top-level span, got parent %q", outer.ParentObservationId)
+	}
+
+	inner := c.SpanFromCtx(outer.Into(ctx), &Span{Name: "inner"})
+	g := c.GenerationFromCtx(inner.Into(ctx), &Generation{Name: "llm"})
+	if inner.ParentObservationId != outer.Id || g.ParentObservationId != inner.Id {
+		t.Fatalf("Expected nested observations, got %q, %q",
+			inner.ParentObservationId, g.ParentObservationId)
+	}
+	if g := c.GenerationFromCtx(ctx, &Generation{}); g.ParentObservationId != "" || g.TraceId != trace.Id {
+		t.Fatalf("Expected generation under the trace, got parent %q", g.ParentObservationId)
+	}
+}
+
+func TestDefaultTags(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{DefaultTags: []string{"service:foo", "env:dev"}})
+	c.Capture()
+
+	trace := c.Trace(&Trace{Tags: []string{"user", "env:dev", "user"}})
+	want := []string{"service:foo", "env:dev", "user"}
+	if !slices.Equal(trace.Tags, want) {
+		t.Fatalf("Expected tags %v, got %v", want, trace.Tags)
+	}
+	c.Ingest(trace)
+	if !slices.Equal(trace.Tags, want) {
+		t.Fatalf("Expected tags %v after update, got %v", want, trace.Tags)
+	}
+}
+
+func TestTraceURL(t *testing.T) {
+	var lookups atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/projects" {
+			http.NotFound(w, r)
+			return
+		}
+		lookups.Add(1)
+		w.Write([]byte(`{"data":[{"id":"proj","name":"test"}]}`))
+	}, ClientOptions{})
+	c.Capture()
+
+	trace := c.Trace(&Trace{Id: "abc"})
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := trace.URL(cancelled, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the lookup cancelled, got %v", err)
+	}
+	for range 2 {
+		got, err := trace.URL(context.Background(), "https://langfuse.example/")
+		if err != nil || got != "https://langfuse.example/project/proj/traces/abc" {
+			t.Fatalf("Unexpected trace URL: %s, %v", got, err)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Fatalf("Expected the project looked up once, got %d", n)
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	msg := "invalid body"
+	err := &BatchError{Errors: []api.IngestionError{
+		{Id: "a", Status: 400, Message: &msg},
+		{Id: "b", Status: 500},
+		{Id: "c", Status: 400},
+		{Id: "d", Status: 500},
+	}}
+	if ids := err.FailedIDs(); !slices.Equal(ids, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("Unexpected failed ids: %v", ids)
+	}
+	if errs := err.ByStatus(400); len(errs) != 2 || errs[1].Id != "c" {
+		t.Fatalf("Unexpected 400 failures: %v", errs)
+	}
+	want := "langfuse: 4 events failed to ingest\n" +
+		"\ta: 400 invalid body\n" +
+		"\tb: 500\n" +
+		"\tc: 400\n" +
+		"\t... and 1 more"
+	if got := err.Error(); got != want {
+		t.Fatalf("Unexpected error:\n%s", got)
+	}
+}
+
+func TestFlushRetryable(t *testing.T) {
+	var envelopes []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Batch []struct {
+				Id   string `json:"id"`
+				Body struct {
+					Id string `json:"id"`
+				} `json:"body"`
+			} `json:"batch"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode batch: %v", err)
+		}
+		ack := api.IngestionResponse{}
+		for _, env := range req.Batch {
+			envelopes = append(envelopes, env.Id)
+			switch env.Body.Id {
+			case "invalid":
+				ack.Errors = append(ack.Errors, api.IngestionError{Id: env.Id, Status: 400})
+			case "transient":
+				ack.Errors = append(ack.Errors, api.IngestionError{Id: env.Id, Status: 500})
+			default:
+				ack.Successes = append(ack.Successes, api.IngestionSuccess{Id: env.Id, Status: 201})
+			}
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(ack)
+	}, ClientOptions{})
+
+	for _, id := range []string{"ok", "invalid", "transient"} {
+		c.Ingest(&Event{Id: id, StartTime: time.Now()})
+	}
+	err := c.Flush(context.Background())
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected batch failure, got %v", err)
+	}
+	if ids := batchErr.FailedIDs(); !slices.Equal(ids, []string{"invalid", "transient"}) {
+		t.Fatalf("Expected failures reported by event ids, got %v", ids)
+	}
+	if len(c.buffer) != 1 || c.buffer[0].Body.EventId() != "transient" {
+		t.Fatalf("Expected only the transient failure buffered, got %v", c.buffer)
+	}
+
+	c.Flush(context.Background())
+	if len(envelopes) != 4 || envelopes[3] != envelopes[2] {
+		t.Fatalf("Expected the retry to reuse the envelope id, got %v", envelopes)
+	}
+}
+
+func TestFlushAt(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{FlushAt: 3})
+	sink := c.Capture()
+
+	trace := c.Trace(&Trace{Name: "auto"})
+	span := trace.Span(&Span{Name: "step"})
+	if n := len(sink.Events()); n != 0 {
+		t.Fatalf("Expected nothing flushed yet, got %d events", n)
+	}
+	if err := span.EndContext(context.Background()); err != nil {
+		t.Fatalf("Failed to end span: %v", err)
+	}
+	if n := len(sink.Events()); n != 3 {
+		t.Fatalf("Expected 3 events flushed, got %d", n)
+	}
+
+	g := trace.Generation(&Generation{Name: "llm"})
+	c.Ingest(&Event{Name: "tick"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.EndContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the flush cancelled, got %v", err)
+	}
+	if g.EventType() != GENERATION_UPDATE {
+		t.Fatalf("Expected generation update, got %s", g.EventType())
+	}
+}
+
+func TestRollupCosts(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{RollupCosts: true})
+	sink := c.Capture()
+
+	trace := c.Trace(&Trace{Name: "costly"})
+	span := trace.Span(&Span{Name: "step"})
+	span.Generation(&Generation{
+		CostDetails:  map[string]float64{"total": 0.5},
+		UsageDetails: map[string]int{"input": 10, "output": 5},
+	})
+	g := trace.Generation(&Generation{CostDetails: map[string]float64{"total": 0.25}})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	// the update of the same generation replaces it in the totals
+	g.CostDetails["total"] = 1
+	g.End()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	events := sink.Events()
+	update, ok := events[len(events)-1].(*traceUpdate)
+	if !ok || update.Id != trace.Id {
+		t.Fatalf("Expected the trace update last, got %#v", events[len(events)-1])
+	}
+	rollup := update.Metadata["rollup"].(map[string]any)
+	if cost := rollup["costDetails"].(map[string]float64); cost["total"] != 1.5 {
+		t.Fatalf("Expected total cost 1.5, got %v", cost)
+	}
+	if usage := rollup["usageDetails"].(map[string]float64); usage["input"] != 10 {
+		t.Fatalf("Expected input usage 10, got %v", usage)
+	}
+}
+
+func TestRollupEviction(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{RollupCosts: true})
+	c.Capture()
+
+	first := c.Trace(&Trace{})
+	first.Generation(&Generation{CostDetails: map[string]float64{"total": 1}})
+	for range maxRollups {
+		c.Trace(&Trace{}).Generation(&Generation{})
+		if err := c.Flush(context.Background()); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+	if n := len(c.rollups); n != maxRollups {
+		t.Fatalf("Expected %d traces kept, got %d", maxRollups, n)
+	}
+	if _, ok := c.rollups[first.Id]; ok {
+		t.Fatalf("Expected the least recently flushed trace forgotten")
+	}
+}
+
+func TestSharedSpan(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	span := c.Trace(&Trace{Name: "shared"}).Span(&Span{Name: "parent"})
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			span.Span(&Span{Name: "child"}).End()
+			span.Update(func(s *Span) { s.Output = i })
+			span.End()
+		}()
+		go func() {
+			defer wg.Done()
+			c.Flush(context.Background())
+		}()
+	}
+	wg.Wait()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// created, updated by every goroutine, and ended once
+	var n int
+	for _, e := range sink.Events() {
+		if e == span {
+			n++
+		}
+	}
+	if n != 10 {
+		t.Fatalf("Expected the span ingested 10 times, got %d", n)
+	}
+}
+
+func TestProjectOption(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request with the project set: %s", r.URL)
+	}, ClientOptions{Project: "proj"})
+	c.Capture()
+
+	if id, err := c.ProjectID(context.Background()); err != nil || id != "proj" {
+		t.Fatalf("Expected the project from options, got %q, %v", id, err)
+	}
+	trace := c.Trace(&Trace{Id: "abc"})
+	if got, _ := trace.URL(context.Background(), ""); got != c.opts.Host+"/project/proj/traces/abc" {
+		t.Fatalf("Unexpected trace URL: %s", got)
+	}
+}
+
+func TestModelParameters(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	g := c.Trace(&Trace{Name: "chat"}).Generation(&Generation{
+		ModelParameters: map[string]any{
+			"temperature": 0.7,
+			"max_tokens":  256,
+			"stream":      false,
+			"stop":        []any{"\n", "END"},
+			"tools":       map[string]any{"type": "function"},
+			"seed":        nil,
+		},
+	})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	want := map[string]any{
+		"temperature": 0.7,
+		"max_tokens":  256,
+		"stream":      false,
+		"stop":        []string{"\n", "END"},
+		"tools":       `{"type":"function"}`,
+	}
+	if !reflect.DeepEqual(g.ModelParameters, want) {
+		t.Fatalf("Expected %v, got %v", want, g.ModelParameters)
+	}
+	events := sink.Events()
+	log, ok := events[len(events)-1].(*sdkLog)
+	if !ok || log.EventType() != SDK_LOG {
+		t.Fatalf("Expected the normalization logged, got %v", events)
+	}
+	if got := log.Log.(map[string]any)["parameters"]; !reflect.DeepEqual(got, []string{"seed", "stop", "tools"}) {
+		t.Fatalf("Expected the normalized parameters logged, got %v", got)
+	}
+}
+
+func TestGenerations(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	span := c.Trace(&Trace{Name: "fanout"}).Span(&Span{Name: "vote"})
+	gs := span.Generations(&Generation{Model: "a"}, &Generation{Model: "b"}, &Generation{Model: "c"})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	for _, g := range gs {
+		if g.Id == "" || g.TraceId != span.TraceId || g.ParentObservationId != span.Id {
+			t.Fatalf("Expected the generation under the span, got %+v", g)
+		}
+	}
+	if n := len(sink.Events()); n != 5 {
+		t.Fatalf("Expected the trace, span, and 3 generations, got %d events", n)
+	}
+}
+
+func TestFlushN(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	c.Capture()
+
+	trace := c.Trace(&Trace{Name: "count"})
+	trace.Span(&Span{Name: "step"}).End()
+	n, err := c.FlushN(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("Expected 3 events flushed, got %d", n)
+	}
+	if n, _ := c.FlushN(context.Background()); n != 0 {
+		t.Fatalf("Expected the buffer drained, got %d more", n)
+	}
+}
+
+func TestBatchOrder(t *testing.T) {
+	var batch []struct {
+		Type     EventType `json:"type"`
+		Metadata struct {
+			Seq uint64 `json:"seq"`
+		} `json:"metadata"`
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Batch json.RawMessage `json:"batch"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.Unmarshal(req.Batch, &batch)
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}, ClientOptions{})
+
+	c.Trace(&Trace{Name: "order"}).Span(&Span{Name: "quick"}).End()
+	// out of order, as the buffer may be after the retries
+	c.mu.Lock()
+	c.buffer = append(c.buffer[1:], c.buffer[0])
+	c.mu.Unlock()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	want := []EventType{TRACE_CREATE, SPAN_CREATE, SPAN_UPDATE}
+	if len(batch) != len(want) {
+		t.Fatalf("Expected %d events, got %d", len(want), len(batch))
+	}
+	for i, env := range batch {
+		if env.Type != want[i] {
+			t.Fatalf("Expected %v, got %v at %d", want[i], env.Type, i)
+		}
+		if i > 0 && env.Metadata.Seq <= batch[i-1].Metadata.Seq {
+			t.Fatalf("Expected increasing sequence, got %d after %d", env.Metadata.Seq, batch[i-1].Metadata.Seq)
+		}
+	}
+}
+
+func TestChunkOrder(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		order []EventType
+		down  atomic.Bool
+	)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Batch []struct {
+				Type EventType `json:"type"`
+			} `json:"batch"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		typ := req.Batch[0].Type
+		mu.Lock()
+		order = append(order, typ)
+		mu.Unlock()
+		if typ == TRACE_CREATE {
+			if down.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			time.Sleep(50 * time.Millisecond) // the later chunks mustn't overtake
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}, ClientOptions{BatchSize: 1, Concurrency: 4})
+
+	c.Trace(&Trace{Name: "order"}).Span(&Span{Name: "quick"}).End()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	want := []EventType{TRACE_CREATE, SPAN_CREATE, SPAN_UPDATE}
+	if !slices.Equal(order, want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+
+	down.Store(true)
+	order = nil
+	c.Trace(&Trace{Name: "orphans"}).Span(&Span{Name: "quick"}).End()
+	err := c.Flush(context.Background())
+	var unsent *UnsentError
+	if !errors.As(err, &unsent) || len(unsent.Unsent()) != 3 {
+		t.Fatalf("Expected the children left unsent along with the trace, got %v", err)
+	}
+	if len(order) != 1 {
+		t.Fatalf("Expected only the trace sent, got %v", order)
+	}
+}
+
+func TestBatchRetries(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}, ClientOptions{Retries: 2, Backoff: backoff.Exponential{Base: time.Millisecond}})
+
+	c.Ingest(&Event{Id: "event", StartTime: time.Now()})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected the batch retried, got %v", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var revoked atomic.Bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/public/health":
+			w.Write([]byte(`{"status":"OK","version":"3.1.0"}`))
+		case "/api/public/projects":
+			if revoked.Load() {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"proj","name":"test"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}, ClientOptions{})
+
+	health, err := c.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to check health: %v", err)
+	}
+	if health.Version != "3.1.0" {
+		t.Fatalf("Expected the server version, got %+v", health)
+	}
+	revoked.Store(true)
+	if _, err := c.Health(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected the keys rejected, got %v", err)
+	}
+}
+
+func TestMillis(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CET", 3600))
+	end := start.Add(time.Second)
+	b, err := json.Marshal(&Span{Id: "s", StartedAt: start, EndedAt: &end})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var got map[string]any
+	json.Unmarshal(b, &got)
+	if got["startTime"] != "2025-01-02T02:04:05.123Z" || got["endTime"] != "2025-01-02T02:04:06.123Z" {
+		t.Fatalf("Expected millisecond UTC timestamps, got %s", b)
+	}
+
+	b, _ = json.Marshal(&Observation{Id: "o", Kind: KindEvent})
+	if strings.Contains(string(b), "startTime") {
+		t.Fatalf("Expected the zero start time omitted, got %s", b)
+	}
+}
+
+func TestContinueTrace(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	trace := c.ContinueTrace("upstream")
+	span := trace.Span(&Span{Name: "step"})
+	g := trace.Generation(&Generation{Name: "llm"})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if span.TraceId != "upstream" || g.TraceId != "upstream" {
+		t.Fatalf("Expected the observations under the trace, got %q, %q", span.TraceId, g.TraceId)
+	}
+	if events := sink.Events(); len(events) != 2 || events[0] != span {
+		t.Fatalf("Expected only the observations ingested, got %v", events)
+	}
+}
+
+func TestParentsFirst(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	g := &Generation{Id: "g", TraceId: "t", ParentObservationId: "s"}
+	s := &Span{Id: "s", TraceId: "t"}
+	trace := &Trace{Id: "t"}
+	e := &Event{Id: "e", TraceId: "elsewhere"}
+	for _, event := range []Ingestible{g, s, trace, e} {
+		c.Ingest(event)
+	}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	want := []Ingestible{trace, s, g, e}
+	if got := sink.Events(); !slices.Equal(got, want) {
+		t.Fatalf("Expected the parents first, got %v", got)
+	}
+}
+
+func TestUploadMedia(t *testing.T) {
+	var (
+		host    string
+		put     []byte
+		patched api.PatchMediaBody
+	)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/public/media":
+			json.NewEncoder(w).Encode(map[string]any{
+				"mediaId":   "m",
+				"uploadUrl": host + "/upload",
+			})
+		case "PUT /upload":
+			put, _ = io.ReadAll(r.Body)
+		case "PATCH /api/public/media/m":
+			json.NewDecoder(r.Body).Decode(&patched)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}, ClientOptions{})
+	host = c.opts.Host
+
+	ref, err := c.UploadMedia(context.Background(), &Media{
+		TraceId:     "t",
+		Field:       "output",
+		ContentType: "image/png",
+		Data:        []byte("png"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	if want := "@@@langfuseMedia:type=image/png|id=m|source=bytes@@@"; ref != want {
+		t.Fatalf("Expected %s, got %s", want, ref)
+	}
+	if string(put) != "png" || patched.UploadHttpStatus != http.StatusOK {
+		t.Fatalf("Expected the media uploaded, and reported, got %q, %d", put, patched.UploadHttpStatus)
+	}
+}
+
+// cancelling cancels the flush once the first chunk is sent.
+type cancelling struct {
+	nopMetrics
+	cancel context.CancelFunc
+}
+
+func (m cancelling) Batched(int, error) { m.cancel() }
+
+func TestFlushDeadline(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Batch []struct {
+				Body struct {
+					Id string `json:"id"`
+				} `json:"body"`
+			} `json:"batch"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		for _, env := range req.Batch {
+			received = append(received, env.Body.Id)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[],"errors":[]}`))
+	}, ClientOptions{BatchSize: 1, Metrics: cancelling{cancel: cancel}})
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		c.Ingest(&Event{Id: id, StartTime: time.Now()})
+	}
+	err := c.Flush(ctx)
+	var unsent *UnsentError
+	if !errors.As(err, &unsent) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the events not sent due to the context, got %v", err)
+	}
+	if n := len(unsent.Unsent()); n != 3 {
+		t.Fatalf("Expected 3 events not sent, got %d", n)
+	}
+
+	c.opts.Metrics = nopMetrics{}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if !slices.Equal(received, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("Expected every event sent once, got %v", received)
+	}
+}
+
+func TestDeleteTrace(t *testing.T) {
+	var deleted []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "DELETE /api/public/traces/gone":
+			http.NotFound(w, r)
+		case "DELETE /api/public/traces/t":
+			deleted = append(deleted, "t")
+		case "DELETE /api/public/traces":
+			var body api.TraceDeleteMultipleJSONRequestBody
+			json.NewDecoder(r.Body).Decode(&body)
+			deleted = append(deleted, body.TraceIds...)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}, ClientOptions{})
+
+	ctx := context.Background()
+	if err := c.DeleteTrace(ctx, "t"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := c.DeleteTrace(ctx, "gone"); err != nil {
+		t.Fatalf("Expected the missing trace deleted, got %v", err)
+	}
+	if err := c.DeleteTraces(ctx, "a", "b"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if !slices.Equal(deleted, []string{"t", "a", "b"}) {
+		t.Fatalf("Unexpected deletions: %v", deleted)
+	}
+}
+
+func TestPending(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{FlushAt: 10})
+	sink := c.Capture()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				c.Ingest(&Event{Name: "concurrent"})
+				if n := c.Pending(); n < 0 || n >= 10+8 {
+					t.Errorf("Unexpected pending count: %d", n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	n := c.Pending()
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if c.Pending() != 0 || len(sink.Events()) != 200 || n >= 10 {
+		t.Fatalf("Expected all 200 events flushed, got %d, and %d pending before", len(sink.Events()), n)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var agents []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+	}
+	ctx := context.Background()
+	newTestClient(t, h, ClientOptions{}).DeleteTrace(ctx, "t")
+	newTestClient(t, h, ClientOptions{UserAgent: "agent/1.0"}).DeleteTrace(ctx, "t")
+	if !slices.Equal(agents, []string{"cablectl/devel", "agent/1.0"}) {
+		t.Fatalf("Unexpected user agents: %v", agents)
+	}
+}
+
+func TestHideOutput(t *testing.T) {
+	c := newTestClient(t, nil, ClientOptions{})
+	sink := c.Capture()
+
+	span := c.Trace(&Trace{}).Span(&Span{Name: "tool"})
+	g := span.Generation(&Generation{
+		Input:      "prompt",
+		Output:     "secret",
+		Metadata:   map[string]any{"tokens": 2},
+		HideOutput: true,
+	})
+	g.Update(func(g *Generation) { g.Output = "still secret" })
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	b, _ := json.Marshal(sink.Events()[2])
+	if s := string(b); strings.Contains(s, "secret") || !strings.Contains(s, `"input":"prompt"`) {
+		t.Fatalf("Expected the output left out, got %s", s)
+	}
+	if g.Output != "still secret" {
+		t.Fatalf("Expected the generation to keep its output, got %v", g.Output)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var reused []bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {}, ClientOptions{
+		OnConnection: func(info httptrace.GotConnInfo) {
+			reused = append(reused, info.Reused)
+		},
+	})
+	for range 2 {
+		if err := c.DeleteTrace(context.Background(), "t"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+	if !slices.Equal(reused, []bool{false, true}) {
+		t.Fatalf("Expected the connection reused, got %v", reused)
+	}
+
+	own := &http.Transport{}
+	c = newTestClient(t, nil, ClientOptions{
+		HTTPClient:  &http.Client{Transport: own},
+		Concurrency: 8,
+	})
+	if n := c.opts.HTTPClient.Transport.(*http.Transport).MaxIdleConnsPerHost; n != 8 || own.MaxIdleConnsPerHost != 0 {
+		t.Fatalf("Expected the copy of the transport pooling 8 connections, got %d", n)
+	}
+}
+
+func TestGenerationFromOpenAI(t *testing.T) {
+	req := map[string]any{
+		"model":       "gpt-4o",
+		"messages":    []map[string]any{{"role": "user", "content": "hi"}},
+		"temperature": 0.2,
+		"stream":      true,
+	}
+	resp := `{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o-2024-08-06",
+		"choices": [{"message": {"role": "assistant", "content": "hello"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12,
+			"prompt_tokens_details": {"cached_tokens": 4}}
+	}`
+	g, err := GenerationFromOpenAI(req, resp)
+	if err != nil {
+		t.Fatalf("Failed to map: %v", err)
+	}
+	if g.Model != "gpt-4o-2024-08-06" || !reflect.DeepEqual(g.ModelParameters, map[string]any{"temperature": 0.2}) {
+		t.Fatalf("Unexpected model: %s %v", g.Model, g.ModelParameters)
+	}
+	if out := g.Output.(map[string]any); out["content"] != "hello" {
+		t.Fatalf("Unexpected output: %v", g.Output)
+	}
+	want := map[string]int{"input": 6, "input_cached_tokens": 4, "output": 2, "total": 12}
+	if !reflect.DeepEqual(g.UsageDetails, want) {
+		t.Fatalf("Unexpected usage: %v", g.UsageDetails)
+	}
+
+	s := &OpenAIStream{Request: req}
+	for _, chunk := range []string{
+		`{"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"hel"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call","function":{"name":"run","arguments":"{\"co"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"lo","tool_calls":[{"index":0,"function":{"arguments":"de\":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`,
+	} {
+		if err := s.Add(chunk); err != nil {
+			t.Fatalf("Failed to add the chunk: %v", err)
+		}
+	}
+	g, err = s.Generation()
+	if err != nil {
+		t.Fatalf("Failed to map the stream: %v", err)
+	}
+	if g.CompletionAt == nil {
+		t.Fatalf("Expected the completion start stamped")
+	}
+	b, _ := json.Marshal(g.Output)
+	if s := string(b); s != `{"content":"hello","role":"assistant","tool_calls":[{"function":{"arguments":"{\"code\":1}","name":"run"},"id":"call","type":"function"}]}` {
+		t.Fatalf("Unexpected output: %s", s)
+	}
+	if md := g.Metadata.(map[string]any); md["finish_reason"] != "tool_calls" {
+		t.Fatalf("Unexpected metadata: %v", md)
+	}
+
+	s = &OpenAIStream{Request: req}
+	if err := s.Add(`{"choices":`); err == nil {
+		t.Fatalf("Expected the malformed chunk to fail")
+	}
+	if !s.first.IsZero() {
+		t.Fatalf("Expected the completion start not stamped on the malformed chunk")
+	}
+	err = s.Add(`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call","function":{"name":"run","arguments":"{}"}}]}}]}`)
+	if err != nil {
+		t.Fatalf("Failed to add the chunk: %v", err)
+	}
+	if g, err = s.Generation(); err != nil {
+		t.Fatalf("Failed to map the stream: %v", err)
+	}
+	if out := g.Output.(map[string]any); out["content"] != nil {
+		t.Fatalf("Expected null content for the tool calls alone, got %q", out["content"])
+	}
+}
+
+// counting is the codec that counts the calls of encoding/json.
+type counting struct {
+	marshal, unmarshal atomic.Int32
+}
+
+func (c *counting) Marshal(v any) ([]byte, error) {
+	c.marshal.Add(1)
+	return json.Marshal(v)
+}
+
+func (c *counting) Unmarshal(data []byte, v any) error {
+	c.unmarshal.Add(1)
+	return json.Unmarshal(data, v)
+}
+
+func TestSetCodec(t *testing.T) {
+	cc := &counting{}
+	SetCodec(cc)
+	t.Cleanup(func() { SetCodec(nil) })
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"successes":[{"id":"e","status":201}],"errors":[]}`))
+	}, ClientOptions{})
+	c.Ingest(&Event{Id: "e"})
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	// the batch, and the event in it
+	if cc.marshal.Load() != 2 || cc.unmarshal.Load() != 1 {
+		t.Fatalf("Expected the batch, its event, and the ack through the codec, got %d, %d",
+			cc.marshal.Load(), cc.unmarshal.Load())
+	}
+}
+
+// BenchmarkEncodeBatch encodes a thousand sizeable generations; the encodes
+// per op, i.e. the batch, and every event in it, are all up to SetCodec, so
+// a replacement is best compared by benchstat of the runs with, and without.
+func BenchmarkEncodeBatch(b *testing.B) {
+	now := time.Now()
+	envs := make([]*envelope, 1000)
+	for i := range envs {
+		envs[i] = wrap(&Generation{
+			Id:              "generation",
+			TraceId:         "trace",
+			StartedAt:       now,
+			EndedAt:         &now,
+			Model:           "gpt-4o",
+			ModelParameters: map[string]any{"temperature": 0.2},
+			Input:           []map[string]any{{"role": "user", "content": strings.Repeat("lorem ipsum ", 100)}},
+			Output:          map[string]any{"role": "assistant", "content": strings.Repeat("dolor sit amet ", 100)},
+			UsageDetails:    map[string]int{"input": 300, "output": 300},
+		})
+	}
+	cc := &counting{}
+	SetCodec(cc)
+	defer SetCodec(nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := encodeBatch(envs); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(cc.marshal.Load())/float64(b.N), "encodes/op")
+}
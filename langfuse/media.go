@@ -0,0 +1,104 @@
+package langfuse
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// Media is a file, such as an image, attached to the field of the trace,
+// or observation.
+type Media struct {
+	TraceId       string
+	ObservationId string // none, if attached to the trace
+	Field         string // input, output, or metadata
+	ContentType   string
+	Data          []byte
+}
+
+// UploadMedia uploads the media, and returns the reference to put in the
+// field in its place, which Langfuse renders as the media.
+//
+// The media already uploaded, as per its hash, is not uploaded again.
+func (c *Client) UploadMedia(ctx context.Context, m *Media) (string, error) {
+	sum := sha256.Sum256(m.Data)
+	hash := base64.StdEncoding.EncodeToString(sum[:])
+	req := api.GetMediaUploadUrlRequest{
+		TraceId:       m.TraceId,
+		Field:         m.Field,
+		ContentType:   api.MediaContentType(m.ContentType),
+		ContentLength: len(m.Data),
+		Sha256Hash:    hash,
+	}
+	if m.ObservationId != "" {
+		req.ObservationId = &m.ObservationId
+	}
+	resp, err := c.API.MediaGetUploadUrl(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("langfuse: get upload url: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200, 201:
+	case 401:
+		return "", ErrUnauthorized
+	default:
+		return "", fmt.Errorf("langfuse: get upload url failed with status: %s", resp.Status)
+	}
+	var upload api.GetMediaUploadUrlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return "", fmt.Errorf("langfuse: get upload url decode: %w", err)
+	}
+	ref := fmt.Sprintf("@@@langfuseMedia:type=%s|id=%s|source=bytes@@@", m.ContentType, upload.MediaId)
+	if upload.UploadUrl == nil {
+		return ref, nil
+	}
+	if err := c.upload(ctx, *upload.UploadUrl, upload.MediaId, hash, m); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// upload puts the media to the presigned url, and reports the outcome.
+func (c *Client) upload(ctx context.Context, url, mediaId, hash string, m *Media) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(m.Data))
+	if err != nil {
+		return fmt.Errorf("langfuse: upload media: %w", err)
+	}
+	req.Header.Set("Content-Type", m.ContentType)
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("X-Amz-Checksum-Sha256", hash)
+	c.traced(ctx, req)
+
+	start := time.Now()
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("langfuse: upload media: %w", err)
+	}
+	resp.Body.Close()
+	elapsed := int(time.Since(start).Milliseconds())
+	patch := api.PatchMediaBody{
+		UploadedAt:       time.Now().UTC(),
+		UploadHttpStatus: resp.StatusCode,
+		UploadTimeMs:     &elapsed,
+	}
+	if resp.StatusCode >= 300 {
+		patch.UploadHttpError = &resp.Status
+	}
+	presp, err := c.API.MediaPatch(ctx, mediaId, patch)
+	if err != nil {
+		return fmt.Errorf("langfuse: patch media: %w", err)
+	}
+	presp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("langfuse: upload media failed with status: %s", resp.Status)
+	}
+	return nil
+}
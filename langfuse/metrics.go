@@ -0,0 +1,19 @@
+package langfuse
+
+// Metrics receives instrumentation events from the client.
+//
+// The package doesn't depend on any metrics library; implement this
+// against your registry of choice, and provide it in ClientOptions.
+type Metrics interface {
+	// Batched is called after every batch ingestion with the number of
+	// events in the batch, and the resulting error, if any.
+	Batched(n int, err error)
+	// Retried is called when n events are put back into the buffer to
+	// be retried with the next flush.
+	Retried(n int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Batched(int, error) {}
+func (nopMetrics) Retried(int)        {}
@@ -0,0 +1,266 @@
+package langfuse
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// openaiParameters are the request fields recorded as the model parameters.
+var openaiParameters = []string{
+	"temperature",
+	"top_p",
+	"max_tokens",
+	"max_completion_tokens",
+	"frequency_penalty",
+	"presence_penalty",
+	"seed",
+	"stop",
+	"n",
+	"reasoning_effort",
+	"response_format",
+}
+
+type openaiResponse struct {
+	Id                string         `json:"id"`
+	Model             string         `json:"model"`
+	SystemFingerprint string         `json:"system_fingerprint"`
+	Choices           []openaiChoice `json:"choices"`
+	Usage             *openaiUsage   `json:"usage"`
+}
+
+type openaiChoice struct {
+	Message      map[string]any `json:"message"`
+	FinishReason string         `json:"finish_reason"`
+}
+
+type openaiUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+type openaiChunk struct {
+	Id                string `json:"id"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Choices           []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				Id       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openaiUsage `json:"usage"`
+}
+
+// GenerationFromOpenAI maps the chat completion request, and its response,
+// into the generation: the model, its parameters, the input messages, the
+// output message, or messages, if there are more choices, and the usage;
+// Langfuse infers the cost from the model, and the usage.
+//
+// The request, and response, are of any type that encodes to the OpenAI
+// JSON, such as the types of the SDK, maps, or the raw JSON itself. The
+// generation is yet to be started, see Span.Generation.
+func GenerationFromOpenAI(req, resp any) (*Generation, error) {
+	var r openaiResponse
+	if err := decodeOpenAI(resp, &r); err != nil {
+		return nil, fmt.Errorf("langfuse: openai response: %w", err)
+	}
+	return openaiGeneration(req, &r)
+}
+
+// OpenAIStream accumulates the streamed chat completion chunks, see
+// GenerationFromOpenAI; the completion start is stamped on the first one.
+//
+// Make sure to request the usage with stream_options.include_usage.
+type OpenAIStream struct {
+	Request any
+
+	first   time.Time
+	resp    openaiResponse
+	content []*strings.Builder
+	tools   [][]map[string]any // by choice, and tool call index
+}
+
+// Add accumulates the chunk.
+func (s *OpenAIStream) Add(chunk any) error {
+	var c openaiChunk
+	if err := decodeOpenAI(chunk, &c); err != nil {
+		return fmt.Errorf("langfuse: openai chunk: %w", err)
+	}
+	if s.first.IsZero() {
+		s.first = time.Now().UTC()
+	}
+	s.resp.Id = cmp.Or(c.Id, s.resp.Id)
+	s.resp.Model = cmp.Or(c.Model, s.resp.Model)
+	s.resp.SystemFingerprint = cmp.Or(c.SystemFingerprint, s.resp.SystemFingerprint)
+	if c.Usage != nil {
+		s.resp.Usage = c.Usage
+	}
+	for _, ch := range c.Choices {
+		for len(s.resp.Choices) <= ch.Index {
+			s.resp.Choices = append(s.resp.Choices, openaiChoice{})
+			s.content = append(s.content, &strings.Builder{})
+			s.tools = append(s.tools, nil)
+		}
+		choice := &s.resp.Choices[ch.Index]
+		if choice.Message == nil {
+			choice.Message = map[string]any{"role": "assistant"}
+		}
+		if ch.Delta.Role != "" {
+			choice.Message["role"] = ch.Delta.Role
+		}
+		s.content[ch.Index].WriteString(ch.Delta.Content)
+		for _, tc := range ch.Delta.ToolCalls {
+			tools := s.tools[ch.Index]
+			for len(tools) <= tc.Index {
+				tools = append(tools, map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": "", "arguments": ""},
+				})
+			}
+			call := tools[tc.Index]
+			if tc.Id != "" {
+				call["id"] = tc.Id
+			}
+			if tc.Type != "" {
+				call["type"] = tc.Type
+			}
+			fn := call["function"].(map[string]any)
+			fn["name"] = fn["name"].(string) + tc.Function.Name
+			fn["arguments"] = fn["arguments"].(string) + tc.Function.Arguments
+			s.tools[ch.Index] = tools
+		}
+		if ch.FinishReason != nil {
+			choice.FinishReason = *ch.FinishReason
+		}
+	}
+	return nil
+}
+
+// Generation returns the generation of the chunks accumulated so far.
+func (s *OpenAIStream) Generation() (*Generation, error) {
+	for i := range s.resp.Choices {
+		msg := s.resp.Choices[i].Message
+		// null, as OpenAI has it, for the tool calls alone
+		msg["content"] = nil
+		if s.content[i].Len() > 0 {
+			msg["content"] = s.content[i].String()
+		}
+		if len(s.tools[i]) > 0 {
+			msg["tool_calls"] = s.tools[i]
+		}
+	}
+	g, err := openaiGeneration(s.Request, &s.resp)
+	if err != nil {
+		return nil, err
+	}
+	if !s.first.IsZero() {
+		first := s.first
+		g.CompletionAt = &first
+	}
+	return g, nil
+}
+
+func openaiGeneration(req any, resp *openaiResponse) (*Generation, error) {
+	var r map[string]any
+	if err := decodeOpenAI(req, &r); err != nil {
+		return nil, fmt.Errorf("langfuse: openai request: %w", err)
+	}
+	g := &Generation{Input: r["messages"]}
+	g.Model, _ = r["model"].(string)
+	g.Model = cmp.Or(resp.Model, g.Model)
+	for _, k := range openaiParameters {
+		if v, ok := r[k]; ok && v != nil {
+			if g.ModelParameters == nil {
+				g.ModelParameters = map[string]any{}
+			}
+			g.ModelParameters[k] = v
+		}
+	}
+
+	var (
+		outputs []map[string]any
+		reasons []string
+	)
+	for _, c := range resp.Choices {
+		outputs = append(outputs, c.Message)
+		reasons = append(reasons, c.FinishReason)
+	}
+	switch len(outputs) {
+	case 0:
+	case 1:
+		g.Output = outputs[0]
+	default:
+		g.Output = outputs
+	}
+	metadata := map[string]any{}
+	if resp.Id != "" {
+		metadata["completion_id"] = resp.Id
+	}
+	if resp.SystemFingerprint != "" {
+		metadata["system_fingerprint"] = resp.SystemFingerprint
+	}
+	if len(reasons) > 0 {
+		metadata["finish_reason"] = strings.Join(reasons, ",")
+	}
+	if len(metadata) > 0 {
+		g.Metadata = metadata
+	}
+
+	if u := resp.Usage; u != nil {
+		usage := map[string]int{
+			"input":  u.PromptTokens,
+			"output": u.CompletionTokens,
+			"total":  u.TotalTokens,
+		}
+		if n := u.PromptTokensDetails.CachedTokens; n > 0 {
+			usage["input_cached_tokens"] = n
+			usage["input"] -= n
+		}
+		if n := u.CompletionTokensDetails.ReasoningTokens; n > 0 {
+			usage["output_reasoning_tokens"] = n
+			usage["output"] -= n
+		}
+		g.UsageDetails = usage
+	}
+	return g, nil
+}
+
+// decodeOpenAI decodes the value, which is either the JSON, or encodes to it.
+func decodeOpenAI(v, into any) error {
+	var b []byte
+	switch x := v.(type) {
+	case []byte:
+		b = x
+	case json.RawMessage:
+		b = x
+	case string:
+		b = []byte(x)
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(b, into)
+}
@@ -0,0 +1,86 @@
+package langfuse
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// pageLimit is the number of items requested per page.
+const pageLimit = 100
+
+// each walks the pages of the list endpoint, calling fn for every item,
+// until there are no more pages, fn fails, or the context is cancelled.
+func each[T any](ctx context.Context, c *Client, what string, fetch func(page, limit int) (*http.Response, error), fn func(*T) error) error {
+	for page := 1; ; page++ {
+		var resp struct {
+			Data []T                   `json:"data"`
+			Meta api.UtilsMetaResponse `json:"meta"`
+		}
+		err := c.get(what, &resp, func() (*http.Response, error) {
+			return fetch(page, pageLimit)
+		})
+		if err != nil {
+			return err
+		}
+		for i := range resp.Data {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(&resp.Data[i]); err != nil {
+				return err
+			}
+		}
+		if page >= resp.Meta.TotalPages || len(resp.Data) == 0 {
+			return nil
+		}
+	}
+}
+
+// EachTrace calls fn for every trace matching the filter, if any, walking
+// the pages transparently; the traces are associated with the client.
+func (c *Client) EachTrace(ctx context.Context, filter *api.TraceListParams, fn func(*Trace) error) error {
+	var params api.TraceListParams
+	if filter != nil {
+		params = *filter
+	}
+	return each(ctx, c, "traces", func(page, limit int) (*http.Response, error) {
+		params.Page, params.Limit = &page, &limit
+		return c.API.TraceList(ctx, &params)
+	}, func(t *Trace) error {
+		c.Populate(t)
+		return fn(t)
+	})
+}
+
+// EachScore calls fn for every score matching the filter, if any.
+func (c *Client) EachScore(ctx context.Context, filter *api.ScoreV2GetParams, fn func(*Score) error) error {
+	var params api.ScoreV2GetParams
+	if filter != nil {
+		params = *filter
+	}
+	return each(ctx, c, "scores", func(page, limit int) (*http.Response, error) {
+		params.Page, params.Limit = &page, &limit
+		return c.API.ScoreV2Get(ctx, &params)
+	}, fn)
+}
+
+// EachObservation calls fn for every observation matching the filter, if any.
+func (c *Client) EachObservation(ctx context.Context, filter *api.ObservationsGetManyParams, fn func(*api.ObservationsView) error) error {
+	var params api.ObservationsGetManyParams
+	if filter != nil {
+		params = *filter
+	}
+	return each(ctx, c, "observations", func(page, limit int) (*http.Response, error) {
+		params.Page, params.Limit = &page, &limit
+		return c.API.ObservationsGetMany(ctx, &params)
+	}, fn)
+}
+
+// EachDataset calls fn for every dataset of the project.
+func (c *Client) EachDataset(ctx context.Context, fn func(*api.Dataset) error) error {
+	return each(ctx, c, "datasets", func(page, limit int) (*http.Response, error) {
+		return c.API.DatasetsList(ctx, &api.DatasetsListParams{Page: &page, Limit: &limit})
+	}, fn)
+}
@@ -0,0 +1,46 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEachTrace(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		fmt.Fprintf(w, `{"data":[{"id":"%d-a"},{"id":"%d-b"}],`+
+			`"meta":{"page":%d,"limit":2,"totalItems":6,"totalPages":3}}`, page, page, page)
+	}, ClientOptions{})
+
+	var ids []string
+	err := c.EachTrace(context.Background(), nil, func(tr *Trace) error {
+		if tr.client != c {
+			t.Errorf("Expected the trace associated with the client")
+		}
+		ids = append(ids, tr.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to list traces: %v", err)
+	}
+	if len(ids) != 6 || ids[5] != "3-b" {
+		t.Fatalf("Unexpected traces: %v", ids)
+	}
+
+	requests.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	err = c.EachTrace(ctx, nil, func(tr *Trace) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || requests.Load() != 1 {
+		t.Fatalf("Expected to stop once cancelled, got %v after %d requests", err, requests.Load())
+	}
+}
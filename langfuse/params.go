@@ -0,0 +1,113 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// normalize coerces the model parameters of the generation into the types
+// accepted by Langfuse: strings, numbers, booleans, and lists thereof, which
+// are sent as lists of strings. The unsupported values are stringified, or
+// dropped, so that a single bad parameter wouldn't fail the ingestion; the
+// affected keys are returned.
+func normalize(event Ingestible) (changed []string) {
+	var params *map[string]any
+	switch e := event.(type) {
+	case *Generation:
+		params = &e.ModelParameters
+	case *Observation:
+		params = &e.ModelParameters
+	default:
+		return nil
+	}
+	var normalized map[string]any
+	for k, v := range *params {
+		p, ok := modelParameter(v)
+		if ok {
+			continue
+		}
+		if normalized == nil {
+			normalized = maps.Clone(*params)
+		}
+		changed = append(changed, k)
+		if p == nil {
+			delete(normalized, k)
+		} else {
+			normalized[k] = p
+		}
+	}
+	if normalized != nil {
+		*params = normalized
+	}
+	return changed
+}
+
+// modelParameter returns the value as supported, and whether it was already.
+// Otherwise, the value is stringified, if possible, or nil.
+func modelParameter(v any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if scalar(rv.Kind()) {
+		return v, true
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		ss := make([]string, rv.Len())
+		for i := range ss {
+			e := rv.Index(i)
+			for e.Kind() == reflect.Interface && !e.IsNil() {
+				e = e.Elem()
+			}
+			if !scalar(e.Kind()) {
+				return stringify(v)
+			}
+			ss[i] = fmt.Sprint(e.Interface())
+		}
+		if _, ok := v.([]string); ok {
+			return v, true
+		}
+		return ss, false
+	}
+	return stringify(v)
+}
+
+func scalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func stringify(v any) (any, bool) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return string(b), false
+}
+
+// sdkLog is a message of the client itself, ingested along the events.
+type sdkLog struct {
+	id        string
+	timestamp time.Time
+
+	Log any `json:"log"`
+}
+
+func newLog(log any) *sdkLog {
+	return &sdkLog{id: uuid.New().String(), timestamp: time.Now().UTC(), Log: log}
+}
+
+func (l *sdkLog) EventId() string      { return l.id }
+func (l *sdkLog) EventType() EventType { return SDK_LOG }
+func (l *sdkLog) EventTime() time.Time { return l.timestamp }
@@ -0,0 +1,66 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// ProjectID returns the id of the project, as set in the options, or
+// otherwise, the one that the keys belong to.
+//
+// It's looked up once, and cached; failed lookups are retried next time.
+func (c *Client) ProjectID(ctx context.Context) (string, error) {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+	if c.projectId != "" {
+		return c.projectId, nil
+	}
+
+	resp, err := c.API.ProjectsGet(ctx)
+	if err != nil {
+		return "", fmt.Errorf("langfuse: get project: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+	case 401:
+		return "", ErrUnauthorized
+	default:
+		return "", fmt.Errorf("langfuse: get project failed with status: %s", resp.Status)
+	}
+	var projects api.Projects
+	if err := json.NewDecoder(resp.Body).Decode(&projects); err != nil {
+		return "", fmt.Errorf("langfuse: get project decode: %w", err)
+	}
+	if len(projects.Data) == 0 {
+		return "", fmt.Errorf("langfuse: no project for the keys")
+	}
+	c.projectId = projects.Data[0].Id
+	return c.projectId, nil
+}
+
+// URL returns the link to the trace in the Langfuse UI, at the given host,
+// or the client host, if empty.
+//
+// The project is looked up within the context, unless it's already known, see
+// ProjectID. The trace of no client has no project to look up, so its link
+// relies on Langfuse to redirect to the project.
+func (t *Trace) URL(ctx context.Context, host string) (string, error) {
+	if host == "" && t.client != nil {
+		host = t.client.opts.Host
+	}
+	host = strings.TrimRight(host, "/")
+	if t.client == nil {
+		return host + "/trace/" + t.Id, nil
+	}
+
+	project, err := t.client.ProjectID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return host + "/project/" + project + "/traces/" + t.Id, nil
+}
@@ -0,0 +1,209 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/busthorne/cablectl/langfuse/api"
+)
+
+// ErrMissingVariable is returned by the strict compilation of prompts,
+// when a variable is not provided.
+var ErrMissingVariable = errors.New("langfuse: missing prompt variable")
+
+// Prompt is a version of the prompt managed in Langfuse.
+//
+// The text prompts have Text set, whereas the chat prompts have Messages.
+type Prompt struct {
+	Name    string   `json:"name"`
+	Version int      `json:"version"`
+	Type    string   `json:"type"` // text, or chat
+	Labels  []string `json:"labels,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Config  any      `json:"config,omitempty"`
+
+	Text     string     `json:"-"`
+	Messages ChatPrompt `json:"-"`
+
+	// Fallback is set if the prompt was served from the client cache,
+	// as Langfuse was unavailable.
+	Fallback bool `json:"-"`
+}
+
+func (p *Prompt) UnmarshalJSON(b []byte) error {
+	type prompt Prompt
+	var raw struct {
+		prompt
+		Prompt json.RawMessage `json:"prompt"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*p = Prompt(raw.prompt)
+	if len(raw.Prompt) == 0 {
+		return nil
+	}
+	if p.Type == "chat" {
+		return json.Unmarshal(raw.Prompt, &p.Messages)
+	}
+	return json.Unmarshal(raw.Prompt, &p.Text)
+}
+
+func (p Prompt) MarshalJSON() ([]byte, error) {
+	type prompt Prompt
+	var body any = p.Text
+	if p.Type == "chat" {
+		body = p.Messages
+	}
+	return json.Marshal(struct {
+		prompt
+		Prompt any `json:"prompt"`
+	}{prompt(p), body})
+}
+
+// Compile substitutes the {{variables}} in the text prompt, leaving
+// the missing ones as-is.
+func (p *Prompt) Compile(vars map[string]any) string {
+	s, _ := compile(p.Text, vars, false)
+	return s
+}
+
+// CompileStrict is like Compile, but fails on missing variables.
+func (p *Prompt) CompileStrict(vars map[string]any) (string, error) {
+	return compile(p.Text, vars, true)
+}
+
+// ChatMessage is a single message of the chat prompt.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatPrompt is a series of messages with {{variables}}.
+type ChatPrompt []ChatMessage
+
+// Compile substitutes the variables in the messages, ready to be passed to
+// the LLM client, leaving the missing ones as-is.
+func (cp ChatPrompt) Compile(vars map[string]any) []ChatMessage {
+	msgs, _ := cp.compile(vars, false)
+	return msgs
+}
+
+// CompileStrict is like Compile, but fails on missing variables.
+func (cp ChatPrompt) CompileStrict(vars map[string]any) ([]ChatMessage, error) {
+	return cp.compile(vars, true)
+}
+
+func (cp ChatPrompt) compile(vars map[string]any, strict bool) ([]ChatMessage, error) {
+	msgs := make([]ChatMessage, len(cp))
+	for i, msg := range cp {
+		content, err := compile(msg.Content, vars, strict)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i] = ChatMessage{Role: msg.Role, Content: content}
+	}
+	return msgs, nil
+}
+
+var variable = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+func compile(s string, vars map[string]any, strict bool) (string, error) {
+	var missing error
+	s = variable.ReplaceAllStringFunc(s, func(m string) string {
+		name := variable.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		switch {
+		case !ok && strict && missing == nil:
+			missing = fmt.Errorf("%w: %s", ErrMissingVariable, name)
+		case !ok:
+			return m
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	})
+	if missing != nil {
+		return "", missing
+	}
+	return s, nil
+}
+
+// PromptOptions pin the prompt version, either by label, or number; by
+// default, the production version is fetched.
+//
+// With Fallback, should Langfuse be unreachable, or fail with a server
+// error, the version last fetched by the client is returned instead.
+type PromptOptions struct {
+	Label    string
+	Version  int
+	Fallback bool
+}
+
+func (o *PromptOptions) key(name string) string {
+	return fmt.Sprintf("%s@%s#%d", name, o.Label, o.Version)
+}
+
+// GetPrompt fetches the version of the prompt.
+//
+// The returned prompt reports the version that's actually used, which is
+// to be recorded on the generations, see Generation.WithPrompt.
+func (c *Client) GetPrompt(ctx context.Context, name string, opts *PromptOptions) (*Prompt, error) {
+	if opts == nil {
+		opts = &PromptOptions{}
+	}
+	p, unavailable, err := c.getPrompt(ctx, name, opts)
+	if err == nil {
+		c.prompts.Store(opts.key(name), p)
+		return p, nil
+	}
+	if !opts.Fallback || !unavailable {
+		return nil, err
+	}
+	cached, ok := c.prompts.Load(opts.key(name))
+	if !ok {
+		return nil, err
+	}
+	fallback := *cached.(*Prompt)
+	fallback.Fallback = true
+	return &fallback, nil
+}
+
+func (c *Client) getPrompt(ctx context.Context, name string, opts *PromptOptions) (p *Prompt, unavailable bool, err error) {
+	params := &api.PromptsGetParams{}
+	if opts.Label != "" {
+		params.Label = &opts.Label
+	}
+	if opts.Version != 0 {
+		params.Version = &opts.Version
+	}
+	resp, err := c.API.PromptsGet(ctx, name, params)
+	if err != nil {
+		return nil, true, fmt.Errorf("langfuse: get prompt: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("langfuse: get prompt %s failed with status: %s", name, resp.Status)
+		return nil, resp.StatusCode >= 500, err
+	}
+	p = &Prompt{}
+	if err := json.NewDecoder(resp.Body).Decode(p); err != nil {
+		return nil, false, fmt.Errorf("langfuse: get prompt decode: %w", err)
+	}
+	return p, false, nil
+}
+
+// WithPrompt links the generation to the version of the prompt used.
+func (g *Generation) WithPrompt(p *Prompt) *Generation {
+	version := p.Version
+	g.mu.Lock()
+	g.PromptName = p.Name
+	g.PromptVersion = &version
+	g.mu.Unlock()
+	return g
+}
@@ -0,0 +1,78 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestChatPromptCompile(t *testing.T) {
+	cp := ChatPrompt{
+		{Role: "system", Content: "You are a {{ role }}."},
+		{Role: "user", Content: "Count to {{n}}, {{name}}."},
+	}
+	vars := map[string]any{"role": "pirate", "n": 3}
+
+	want := []ChatMessage{
+		{Role: "system", Content: "You are a pirate."},
+		{Role: "user", Content: "Count to 3, {{name}}."},
+	}
+	if got := cp.Compile(vars); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	if _, err := cp.CompileStrict(vars); !errors.Is(err, ErrMissingVariable) {
+		t.Fatalf("Expected missing variable, got %v", err)
+	}
+	vars["name"] = "matey"
+	if got, err := cp.CompileStrict(vars); err != nil || got[1].Content != "Count to 3, matey." {
+		t.Fatalf("Unexpected strict compilation: %v, %v", got, err)
+	}
+}
+
+func TestGetPrompt(t *testing.T) {
+	var down atomic.Bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/public/v2/prompts/greeting" {
+			http.NotFound(w, r)
+			return
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if label := r.URL.Query().Get("label"); label != "staging" {
+			t.Errorf("Expected label staging, got %q", label)
+		}
+		w.Write([]byte(`{"name":"greeting","version":2,"type":"chat",` +
+			`"labels":["production"],"prompt":[{"role":"user","content":"Hi, {{name}}!"}]}`))
+	}, ClientOptions{})
+
+	opts := &PromptOptions{Label: "staging", Fallback: true}
+	p, err := c.GetPrompt(context.Background(), "greeting", opts)
+	if err != nil {
+		t.Fatalf("Failed to get prompt: %v", err)
+	}
+	if p.Version != 2 || len(p.Messages) != 1 {
+		t.Fatalf("Unexpected prompt: %+v", p)
+	}
+	msgs := p.Messages.Compile(map[string]any{"name": "Ada"})
+	if msgs[0].Content != "Hi, Ada!" {
+		t.Fatalf("Unexpected message: %v", msgs[0])
+	}
+
+	down.Store(true)
+	p, err = c.GetPrompt(context.Background(), "greeting", opts)
+	if err != nil || !p.Fallback || p.Version != 2 {
+		t.Fatalf("Expected fallback to the cached version, got %+v, %v", p, err)
+	}
+	if _, err := c.GetPrompt(context.Background(), "greeting", &PromptOptions{Label: "staging"}); err == nil {
+		t.Fatalf("Expected failure without fallback")
+	}
+	g := (&Generation{}).WithPrompt(p)
+	if g.PromptName != "greeting" || *g.PromptVersion != 2 {
+		t.Fatalf("Unexpected prompt link: %s %d", g.PromptName, *g.PromptVersion)
+	}
+}
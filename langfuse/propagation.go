@@ -0,0 +1,87 @@
+package langfuse
+
+import (
+	"errors"
+	"strings"
+)
+
+// SpanContextHeader is the conventional HTTP header for the span context.
+const SpanContextHeader = "Langfuse-Span-Context"
+
+// SpanContext carries the trace, and the parent observation, across service
+// boundaries, so that the downstream observations join the upstream tree.
+//
+// It's serialized as "<traceId>:<observationId>", where the observation is
+// optional; the trace ids must not contain colons.
+type SpanContext struct {
+	TraceId       string `json:"traceId"`
+	ObservationId string `json:"observationId,omitempty"`
+}
+
+// ParseSpanContext parses the serialized span context.
+func ParseSpanContext(s string) (SpanContext, error) {
+	var sc SpanContext
+	return sc, sc.UnmarshalText([]byte(s))
+}
+
+// IsZero reports whether the span context lacks the trace.
+func (sc SpanContext) IsZero() bool {
+	return sc.TraceId == ""
+}
+
+func (sc SpanContext) String() string {
+	if sc.ObservationId == "" {
+		return sc.TraceId
+	}
+	return sc.TraceId + ":" + sc.ObservationId
+}
+
+func (sc SpanContext) MarshalText() ([]byte, error) {
+	if sc.IsZero() {
+		return nil, errors.New("langfuse: span context without trace id")
+	}
+	return []byte(sc.String()), nil
+}
+
+func (sc *SpanContext) UnmarshalText(b []byte) error {
+	trace, obs, _ := strings.Cut(strings.TrimSpace(string(b)), ":")
+	if trace == "" {
+		return errors.New("langfuse: span context without trace id")
+	}
+	sc.TraceId, sc.ObservationId = trace, obs
+	return nil
+}
+
+// Context returns the span context, so that the observations made elsewhere
+// could be nested under this span.
+func (s *Span) Context() SpanContext {
+	return SpanContext{TraceId: s.TraceId, ObservationId: s.Id}
+}
+
+// SpanFromContext resumes the upstream span from its context.
+//
+// The returned span is a stand-in for the remote one: it's not ingested, and
+// must not be ended, but the children created from it are nested under the
+// upstream observation, or directly under the trace, if there's none.
+func (c *Client) SpanFromContext(sc SpanContext) *Span {
+	if sc.IsZero() {
+		panic("langfuse: SpanContext must have a trace id when calling Client.SpanFromContext")
+	}
+	return &Span{
+		Id:      sc.ObservationId,
+		TraceId: sc.TraceId,
+		client:  c,
+	}
+}
+
+// ContinueTrace resumes the trace created elsewhere, i.e. in another process
+// of the workflow, from its id, without fetching it.
+//
+// The returned trace is a stand-in, like the span of SpanFromContext: it's
+// not ingested, but the observations created from it belong to the trace.
+func (c *Client) ContinueTrace(traceId string) *Trace {
+	if traceId == "" {
+		panic("langfuse: trace id is required when calling Client.ContinueTrace")
+	}
+	return &Trace{Id: traceId, client: c}
+}
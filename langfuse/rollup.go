@@ -0,0 +1,133 @@
+package langfuse
+
+import (
+	"container/list"
+	"maps"
+	"time"
+)
+
+// maxRollups is how many traces the client keeps the totals of; beyond it,
+// the traces least recently flushed are forgotten.
+const maxRollups = 1000
+
+// costs are the cost, and usage details of a generation.
+type costs struct {
+	cost, usage map[string]float64
+}
+
+// traceCosts are the costs of the generations of a trace, by generation.
+type traceCosts struct {
+	traceId string
+	costs   map[string]costs
+}
+
+// traceUpdate merges the metadata into the existing trace.
+type traceUpdate struct {
+	Id       string         `json:"id"`
+	Metadata map[string]any `json:"metadata"`
+
+	timestamp time.Time
+}
+
+func (t *traceUpdate) EventId() string      { return t.Id }
+func (t *traceUpdate) EventType() EventType { return TRACE_CREATE }
+func (t *traceUpdate) EventTime() time.Time { return t.timestamp }
+
+// rollup accounts for the generations among the envelopes, and returns
+// the updates of their traces with the running totals in the metadata,
+// under the "rollup" key.
+//
+// The client keeps track of the generations of the recent traces, so that
+// the totals are correct across flushes; see maxRollups.
+func (c *Client) rollup(envs []*envelope) []*envelope {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if c.rollups == nil {
+		c.rollups = map[string]*list.Element{}
+		c.recent = list.New()
+	}
+
+	touched := map[string]bool{}
+	for _, env := range envs {
+		var traceId, id string
+		var cc costs
+		switch g := env.Body.(type) {
+		case *Generation:
+			g.mu.Lock()
+			traceId, id = g.TraceId, g.Id
+			cc = costs{maps.Clone(g.CostDetails), usage(g.UsageDetails)}
+			g.mu.Unlock()
+		case *Observation:
+			if g.Kind != KindGeneration {
+				continue
+			}
+			traceId, id = g.TraceId, g.Id
+			cc = costs{maps.Clone(g.CostDetails), usage(g.UsageDetails)}
+		default:
+			continue
+		}
+		if traceId == "" {
+			continue
+		}
+		e := c.rollups[traceId]
+		if e == nil {
+			e = c.recent.PushFront(&traceCosts{traceId, map[string]costs{}})
+			c.rollups[traceId] = e
+		} else {
+			c.recent.MoveToFront(e)
+		}
+		e.Value.(*traceCosts).costs[id] = cc
+		touched[traceId] = true
+	}
+
+	var updates []*envelope
+	for traceId := range touched {
+		cost, usage := map[string]float64{}, map[string]float64{}
+		for _, cc := range c.rollups[traceId].Value.(*traceCosts).costs {
+			for k, v := range cc.cost {
+				cost[k] += v
+			}
+			for k, v := range cc.usage {
+				usage[k] += v
+			}
+		}
+		updates = append(updates, wrap(&traceUpdate{
+			Id: traceId,
+			Metadata: map[string]any{
+				"rollup": map[string]any{
+					"costDetails":  cost,
+					"usageDetails": usage,
+				},
+			},
+			timestamp: time.Now().UTC(),
+		}))
+	}
+	for c.recent.Len() > maxRollups {
+		t := c.recent.Remove(c.recent.Back()).(*traceCosts)
+		delete(c.rollups, t.traceId)
+	}
+	return updates
+}
+
+// usage returns the numeric usage details.
+func usage(details any) map[string]float64 {
+	m := map[string]float64{}
+	switch d := details.(type) {
+	case map[string]int:
+		for k, v := range d {
+			m[k] = float64(v)
+		}
+	case map[string]float64:
+		maps.Copy(m, d)
+	case map[string]any:
+		for k, v := range d {
+			switch n := v.(type) {
+			case int:
+				m[k] = float64(n)
+			case float64:
+				m[k] = n
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,43 @@
+package langfuse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetScores(t *testing.T) {
+	pages := []string{
+		`[{"id":"1","traceId":"t","name":"accuracy","value":1},` +
+			`{"id":"2","traceId":"t","name":"tone","value":0,"stringValue":"rude","dataType":"CATEGORICAL"}]`,
+		`[{"id":"3","traceId":"t","name":"accuracy","value":0.5},` +
+			`{"id":"4","traceId":"other","name":"accuracy","value":0}]`,
+	}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("traceId") != "t" {
+			t.Errorf("Expected the trace filter, got %s", r.URL.RawQuery)
+		}
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		fmt.Fprintf(w, `{"data":%s,"meta":{"page":%d,"limit":2,"totalItems":4,"totalPages":2}}`,
+			pages[page-1], page)
+	}, ClientOptions{})
+
+	scores, err := c.GetScores(context.Background(), "t")
+	if err != nil {
+		t.Fatalf("Failed to get scores: %v", err)
+	}
+	if len(scores) != 3 {
+		t.Fatalf("Expected 3 scores of the trace, got %d", len(scores))
+	}
+	avg := AverageScores(scores)
+	if _, ok := avg["tone"]; ok || avg["accuracy"] != 0.75 {
+		t.Fatalf("Unexpected averages: %v", avg)
+	}
+
+	scores, err = c.GetScores(context.Background(), "t", "tone")
+	if err != nil || len(scores) != 1 || scores[0].StringValue != "rude" {
+		t.Fatalf("Expected the tone score, got %v, %v", scores, err)
+	}
+}
@@ -0,0 +1,58 @@
+package langfuse
+
+import "context"
+
+type parentKey struct{}
+
+// Into returns a copy of the context carrying the trace, under which the
+// observations created with SpanFromCtx, and GenerationFromCtx, will go.
+func (t *Trace) Into(ctx context.Context) context.Context {
+	return context.WithValue(ctx, parentKey{}, t)
+}
+
+// Into returns a copy of the context carrying the span, which will be
+// the parent of the observations created with SpanFromCtx, and
+// GenerationFromCtx, until a nested span is put into the context.
+func (s *Span) Into(ctx context.Context) context.Context {
+	return context.WithValue(ctx, parentKey{}, s)
+}
+
+// SpanFromCtx creates the span under the innermost span, or trace,
+// in the context.
+func (c *Client) SpanFromCtx(ctx context.Context, s *Span) *Span {
+	switch p := c.parent(ctx, "SpanFromCtx").(type) {
+	case *Trace:
+		return p.Span(s)
+	case *Span:
+		return p.Span(s)
+	}
+	panic("unreachable")
+}
+
+// GenerationFromCtx creates the generation under the innermost span, or
+// trace, in the context.
+func (c *Client) GenerationFromCtx(ctx context.Context, g *Generation) *Generation {
+	switch p := c.parent(ctx, "GenerationFromCtx").(type) {
+	case *Trace:
+		return p.Generation(g)
+	case *Span:
+		return p.Generation(g)
+	}
+	panic("unreachable")
+}
+
+func (c *Client) parent(ctx context.Context, method string) any {
+	switch p := ctx.Value(parentKey{}).(type) {
+	case *Trace:
+		if p.client == nil {
+			c.Populate(p)
+		}
+		return p
+	case *Span:
+		if p.client == nil {
+			c.Populate(p)
+		}
+		return p
+	}
+	panic("langfuse: context must carry a Trace or Span when calling Client." + method)
+}
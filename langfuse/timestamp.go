@@ -0,0 +1,30 @@
+package langfuse
+
+import (
+	"time"
+)
+
+// millis is the time as encoded for Langfuse: RFC 3339 in UTC, with exactly
+// millisecond precision, as some server versions would reject, or truncate
+// inconsistently, the nanoseconds of time.Time, and misorder the events.
+type millis time.Time
+
+const millisLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func (t millis) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, len(millisLayout)+2)
+	b = append(b, '"')
+	b = time.Time(t).UTC().AppendFormat(b, millisLayout)
+	return append(b, '"'), nil
+}
+
+func (t millis) IsZero() bool { return time.Time(t).IsZero() }
+
+// ms is the optional time in milliseconds.
+func ms(t *time.Time) *millis {
+	if t == nil {
+		return nil
+	}
+	m := millis(*t)
+	return &m
+}
@@ -0,0 +1,42 @@
+package langfuse
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// pooled makes sure the transport of the client keeps enough idle
+// connections for the concurrent chunks; otherwise, the connections beyond
+// http.DefaultMaxIdleConnsPerHost are closed after every request, and the
+// heavy tracing would run out of the ephemeral ports.
+//
+// The client is copied, rather than changed, and so is the transport.
+func pooled(hc *http.Client, concurrency int) *http.Client {
+	rt := hc.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok || cmp.Or(t.MaxIdleConnsPerHost, http.DefaultMaxIdleConnsPerHost) >= concurrency {
+		return hc
+	}
+	t = t.Clone()
+	t.MaxIdleConnsPerHost = concurrency
+	t.MaxIdleConns = max(t.MaxIdleConns, concurrency)
+	copied := *hc
+	copied.Transport = t
+	return &copied
+}
+
+// traced is the request editor that reports the connections of the
+// requests to OnConnection, if set.
+func (c *Client) traced(ctx context.Context, req *http.Request) error {
+	if c.opts.OnConnection == nil {
+		return nil
+	}
+	trace := &httptrace.ClientTrace{GotConn: c.opts.OnConnection}
+	*req = *req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return nil
+}
@@ -0,0 +1,123 @@
+package langfuse
+
+import (
+	"maps"
+	"unicode/utf8"
+)
+
+// TruncatedMarker is appended to the fields cut short by MaxFieldBytes.
+const TruncatedMarker = "...[truncated]"
+
+// truncate cuts the oversized input, output, and metadata of the event down
+// to MaxFieldBytes, and records their original sizes under the "truncated"
+// key of the metadata.
+//
+// The fields are measured by their JSON representation, except for strings,
+// which are measured as-is; a truncated field becomes a string, so it's never
+// truncated again when the observation is updated.
+func (c *Client) truncate(event Ingestible) {
+	limit := c.opts.MaxFieldBytes
+	if limit <= 0 {
+		return
+	}
+	input, output, metadata := fields(event)
+	if metadata == nil {
+		return
+	}
+	hideInput, hideOutput := hidden(event)
+	sizes := map[string]int{}
+	for _, f := range []struct {
+		name   string
+		v      *any
+		hidden bool
+	}{{"metadata", metadata, false}, {"input", input, hideInput}, {"output", output, hideOutput}} {
+		if f.hidden {
+			continue // not even its size is sent
+		}
+		if n, ok := truncateField(f.v, limit); ok {
+			sizes[f.name] = n
+		}
+	}
+	if len(sizes) == 0 {
+		return
+	}
+	m := map[string]any{}
+	switch md := (*metadata).(type) {
+	case nil:
+	case map[string]any:
+		maps.Copy(m, md)
+	default:
+		m["metadata"] = md
+	}
+	m["truncated"] = sizes
+	*metadata = m
+}
+
+// hidden tells whether the input, and output, of the observation are left
+// out, as per its HideInput, and HideOutput.
+func hidden(event Ingestible) (input, output bool) {
+	switch e := event.(type) {
+	case *Span:
+		return e.HideInput, e.HideOutput
+	case *Generation:
+		return e.HideInput, e.HideOutput
+	case *Event:
+		return e.HideInput, e.HideOutput
+	case *Observation:
+		return e.HideInput, e.HideOutput
+	}
+	return false, false
+}
+
+// shown is the field as encoded: nil, if it's hidden; the observation itself
+// keeps it, so that its updates, and the caller, still have it.
+func shown(v any, hidden bool) any {
+	if hidden {
+		return nil
+	}
+	return v
+}
+
+// fields returns the free-form fields of the observation, if it has them.
+func fields(event Ingestible) (input, output, metadata *any) {
+	switch e := event.(type) {
+	case *Trace:
+		return &e.Input, &e.Output, &e.Metadata
+	case *Span:
+		return &e.Input, &e.Output, &e.Metadata
+	case *Generation:
+		return &e.Input, &e.Output, &e.Metadata
+	case *Event:
+		return &e.Input, &e.Output, &e.Metadata
+	case *Observation:
+		return &e.Input, &e.Output, &e.Metadata
+	}
+	return nil, nil, nil
+}
+
+// truncateField replaces the value with its truncated representation,
+// if it exceeds the limit, and returns the original size.
+func truncateField(v *any, limit int) (int, bool) {
+	var s string
+	switch x := (*v).(type) {
+	case nil:
+		return 0, false
+	case string:
+		s = x
+	default:
+		b, err := codec.Get().Marshal(x)
+		if err != nil {
+			return 0, false
+		}
+		s = string(b)
+	}
+	if len(s) <= limit {
+		return 0, false
+	}
+	keep := max(limit-len(TruncatedMarker), 0)
+	for keep > 0 && !utf8.RuneStart(s[keep]) {
+		keep--
+	}
+	*v = s[:keep] + TruncatedMarker
+	return len(s), true
+}